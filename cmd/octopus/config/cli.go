@@ -1,9 +1,13 @@
 package config
 
 import (
+	"fmt"
 	"os"
+	"time"
 
 	"github.com/BlaineEXE/octopus/internal/logger"
+	"github.com/BlaineEXE/octopus/internal/octopus"
+	"github.com/BlaineEXE/octopus/internal/ssh"
 	"github.com/BlaineEXE/octopus/internal/version"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -13,6 +17,10 @@ const (
 	defaultGroupsFile = "_node-list"
 )
 
+// Default identity files are skipped with a warning if they don't exist. Identity files the user
+// specifies are not.
+var defaultIdentityFiles = []string{"$HOME/.ssh/id_rsa", "$HOME/.ssh/id_ecdsa", "$HOME/.ssh/id_ed25519"}
+
 // OctopusCmd is the top-level 'octopus' command.
 var OctopusCmd = &cobra.Command{
 	Use:   "octopus [flags] [--host-groups|-h <HOST-GROUPS>] <COMMAND>",
@@ -30,14 +38,159 @@ var OctopusCmd = &cobra.Command{
 	both Octopus and by user-made scripts and has the secondary benefit of
 	supporting defining hosts by IP address as well as hostname.
 
+  Host group entries are of the form [user@]address[:port][,key=value]...
+  An entry's user and port take precedence over all other users and ports.
+  IPv6 addresses with a port must be surrounded by square brackets (e.g.,
+  '[fe80::1]:2222'). Attributes given as key=value (e.g., '10.0.0.5,rack=r1')
+  can be used in command templates (see 'octopus run --help').
+
   Under the hood, Octopus uses ssh connections, and some ssh arguments are
   reflected in Octopus's arguments. These arguments are marked in the help
   text with "(ssh)".
 
-  WARNINGS:
-    Octopus does not do verification of remote hosts (Equivalent to
-    setting ssh option StrictHostKeyChecking=no) and does not add entries
-    to the known hosts file.
+  Host key verification:
+    By default, Octopus verifies remote hosts' keys against the user's
+    known hosts file (~/.ssh/known_hosts), the global known hosts file
+    (/etc/ssh/ssh_known_hosts), and any files given by '--known-hosts-file'.
+    Keys of hosts which are not yet known are added to the user's known hosts
+    file (equivalent to setting ssh option StrictHostKeyChecking=accept-new).
+    Hosts which fail verification are reported as errors. Use
+    '--host-key-checking strict' to reject hosts which are not yet known.
+
+  SSH config file:
+    Octopus reads per-host HostName, User, Port, IdentityFile, ConnectTimeout,
+    and ProxyJump settings from the user's OpenSSH config (~/.ssh/config) and
+    the global config (/etc/ssh/ssh_config), or from the file given by
+    '--ssh-config|-F'. Users and ports given explicitly to Octopus on the
+    commandline or in Octopus's config file take precedence. Identity files
+    from the ssh config are tried after Octopus's own identity files.
+
+  Stdin:
+    If Octopus's stdin is not a terminal (e.g., 'cat config | octopus run
+    "tee /etc/foo.conf"'), all of it is sent to every command run on every
+    host, no matter when the host is reached. Commands see the end of their
+    input once local stdin is closed. Stdin is buffered in a temporary file
+    rather than in memory. Use '--no-stdin|-n' to send nothing, like ssh -n.
+
+  Pseudo-terminals:
+    Some commands behave differently or refuse to run without a terminal
+    (e.g., sudo with requiretty). With '--tty|-t', like ssh -t, each command
+    is given a pseudo-terminal (TERM=xterm, 80 columns by 24 rows). All of
+    the command's output is then stdout, and CRLF line endings written by the
+    terminal are turned back into plain newlines. Local stdin is not sent to
+    commands with a pseudo-terminal.
+
+  Becoming root:
+    With '--become|-b', commands are run as root with '--become-method' (sudo
+    by default, su, or doas), and files copied with 'octopus copy' are owned
+    by root. Files are first copied to a temporary dir as the login user and
+    then moved into place as root so that they can be copied to dirs only
+    root can write. Without a password, commands which need one fail instead
+    of waiting for it; su can't fail this way, so it always needs a password.
+    With '--ask-become-pass|-K', the password is asked for once (or read from
+    the OCTOPUS_BECOME_PASSWORD environment variable) and is sent to each
+    command whenever the become method asks for it. Password prompts are
+    removed from output, and stdin is only sent once the command is running
+    as root. su and doas read the password from a terminal, so they need
+    '--tty' to be given a password. Environment variables set with '--env'
+    are set after becoming root.
+
+  Environment variables:
+    '--env KEY=VALUE' (which may be repeated) sets an environment variable
+    for every command run on every host. Variables can also be set in the
+    config file as a map (e.g., "env: {HTTP_PROXY: http://proxy:3128}"), and
+    '--env' takes precedence for variables set in both places. Variables are
+    sent with ssh's SetEnv, but hosts only accept the variables allowed by
+    AcceptEnv in their sshd config, so if a host refuses any variable, all of
+    them are instead exported at the start of the command.
+
+  Output formats:
+    '--format' picks how results are output. By default ('text'), Octopus
+    prints each host's output together after the host finishes. 'collate'
+    is the same as 'run --collate', and 'stream' is the same as '--stream'.
+    '--output' is another name for '--format'.
+
+  Streaming output:
+    With '--stream' (or '--format stream'), each line of output (stdout and
+    stderr) is printed as soon as it is received, prefixed with "<hostname>: "
+    like pdsh. Lines from different hosts are never mixed together mid-line.
+
+  Machine-readable output:
+    With '--format json', Octopus prints a JSON array of all hosts' results
+    once all hosts have finished. With '--format ndjson', each host's result
+    is printed as a JSON object on its own line as soon as the host finishes.
+    Each result has the fields: host, hostname, stdout, stderr, error
+    (null if none), connected, exit_status, skipped, skip_reason, interrupted,
+    start, end, and duration_seconds. exit_status is an object with the fields code and
+    signal (if the command was killed by a signal; code is then -1), and it
+    is null if the command did not run or did not finish.
+    With '--format none', no results are printed, which is useful when
+    results are only wanted in the files written by 'run --output-dir'.
+
+  Summary:
+    With '--summary', Octopus prints a summary to stderr after all hosts have
+    finished. Failed hosts are grouped by the kind of failure: interrupted,
+    connect (the host was reached, but connecting to it failed), auth (the
+    host rejected all keys), timeout, non-zero exit, and other. Unreachable
+    hosts (which could not be reached at all, e.g., because they are down)
+    and hosts which were skipped are listed separately. The total time and
+    the fastest and slowest hosts are also reported.
+
+  Reports:
+    With '--report junit=<path>', Octopus writes a JUnit XML file after all
+    hosts have finished so that CI systems can show which hosts failed. Each
+    host is a testcase named with its hostname in a class named after the
+    host groups. Its stdout and stderr are the testcase's system-out and
+    system-err. Hosts with errors have a failure element whose type is the
+    kind of failure as reported by '--summary', and skipped hosts have a
+    skipped element.
+
+  Rolling execution:
+    With '--batch N' or '--batch N%', Octopus works on hosts in batches of N
+    hosts (or N percent of all hosts) in the order they appear in the host
+    groups, finishing each batch before beginning the next. '--batch-pause'
+    waits between batches. If more than '--max-failures' hosts fail in a
+    batch, Octopus stops, and the hosts which were not reached are reported
+    as skipped. Skipped hosts are not counted as failed hosts.
+
+  Timeouts:
+    Octopus gives up connecting to a host after '--connect-timeout' (30s by
+    default) and reports a timeout error for the host. Commands which run for
+    longer than '--command-timeout' are killed and also reported as timeout
+    errors. Results from other hosts are reported as they finish and are not
+    held up by slow hosts.
+
+  Interrupting:
+    When Octopus receives SIGINT (e.g., Ctrl-C) or SIGTERM, it sends SIGINT
+    to every command still running on hosts, then SIGTERM and finally SIGKILL
+    to commands which are still running 5 seconds after each signal. Hosts
+    which are still being connected to are given up on, and hosts which have
+    not been reached yet (waiting for '--fanout' or in later batches) are
+    reported as skipped. The results Octopus has are then printed, with
+    interrupted hosts' errors labeled "Interrupted", and Octopus exits with
+    code 130. Temporary files Octopus made on hosts (e.g., for 'octopus
+    script' and '--become') are still removed. A second signal makes Octopus
+    exit right away.
+
+  Jump hosts:
+    Hosts which cannot be reached directly (e.g., nodes on a private network)
+    can be reached by tunneling through one or more jump hosts (bastions) with
+    '--jump|-J [user@]host[:port],...' or with ProxyJump in the ssh config.
+    Jump hosts given to Octopus take precedence over ProxyJump. Each jump host
+    is connected to only once, and the connection is shared by all hosts
+    behind it. If connecting fails or the connection is lost, the jump host
+    is connected to again for the next host. Jump hosts' users, ports, and
+    identity files are taken from the jump host spec and the ssh config, not
+    from Octopus's '--user|-u' and '--port|-p' flags. A jump host's own
+    ProxyJump in the ssh config is ignored with a warning; list every jump
+    host in order instead.
+
+  Encrypted identity files:
+    If an identity file is protected by a passphrase, Octopus asks for the
+    passphrase once on the terminal and uses the decrypted key for all hosts.
+    The passphrase is instead read from the OCTOPUS_PASSPHRASE environment
+    variable if it is set, or from the program given by SSH_ASKPASS if there
+    is no terminal (or if SSH_ASKPASS_REQUIRE=force).
 
   Config file:
     Octopus supports setting custom default values for flags in a config file.
@@ -137,19 +290,112 @@ func init() {
 	OctopusCmd.PersistentFlags().StringP("groups-file", "f", defaultGroupsFile,
 		"file which defines groups of remote hosts available for execution")
 
+	OctopusCmd.PersistentFlags().BoolP("ask-become-pass", "K", false,
+		"ask for the password with which commands become root with '--become'")
+
+	OctopusCmd.PersistentFlags().String("batch", "",
+		"number of hosts (e.g., 10) or percentage of hosts (e.g., 25%) to work on in each batch; "+
+			"each batch finishes before the next begins (default all hosts in one batch)")
+	SetCmdFlagCompletion(OctopusCmd, "batch", BashCompletionEmptyCompletionFunction)
+
+	OctopusCmd.PersistentFlags().Duration("batch-pause", 0,
+		"time to wait between batches (e.g., 30s)")
+	SetCmdFlagCompletion(OctopusCmd, "batch-pause", BashCompletionEmptyCompletionFunction)
+
+	OctopusCmd.PersistentFlags().BoolP("become", "b", false,
+		"run commands and copy files as root on hosts")
+
+	OctopusCmd.PersistentFlags().String("become-method", octopus.SudoBecome,
+		fmt.Sprintf("how commands become root with '--become'; one of %v", octopus.BecomeMethods))
+	SetCmdFlagCompletion(OctopusCmd, "become-method", BashCompletionEmptyCompletionFunction)
+
+	OctopusCmd.PersistentFlags().Int("max-failures", -1,
+		"stop after a batch in which more than this many hosts fail; remaining hosts are reported "+
+			"as skipped, and -1 means never stop")
+	SetCmdFlagCompletion(OctopusCmd, "max-failures", BashCompletionEmptyCompletionFunction)
+
+	OctopusCmd.PersistentFlags().StringArray("env", []string{},
+		"environment variable to set for commands on hosts, given as KEY=VALUE; may be repeated, "+
+			"and values may contain commas")
+	SetCmdFlagCompletion(OctopusCmd, "env", BashCompletionEmptyCompletionFunction)
+
+	OctopusCmd.PersistentFlags().Uint("fanout", 0,
+		"max number of hosts to work on at the same time (like pdsh \"-f\"); 0 means no limit")
+	SetCmdFlagCompletion(OctopusCmd, "fanout", BashCompletionEmptyCompletionFunction)
+
+	OctopusCmd.PersistentFlags().StringP("format", "o", octopus.TextFormat,
+		fmt.Sprintf("format in which results are output; one of %v", octopus.Formats))
+	SetCmdFlagCompletion(OctopusCmd, "format", BashCompletionEmptyCompletionFunction)
+
 	OctopusCmd.PersistentFlags().StringSliceP("host-groups", "g", []string{},
 		"comma-separated list of host groups; the command will be run on each host in every group")
 	SetCmdFlagCompletion(OctopusCmd, "host-groups", "__octopus_get_host_groups")
 
-	OctopusCmd.PersistentFlags().StringP("identity-file", "i", "$HOME/.ssh/id_rsa",
-		"(ssh) file from which the identity (private key) for public key authentication is read")
+	OctopusCmd.PersistentFlags().BoolP("no-stdin", "n", false,
+		"do not send local stdin to commands on hosts (like ssh \"-n\"); stdin is never sent if it "+
+			"is a terminal")
+
+	OctopusCmd.PersistentFlags().StringSliceP("identity-file", "i", defaultIdentityFiles,
+		"(ssh) file from which the identity (private key) for public key authentication is read; "+
+			"may be repeated or given as a comma-separated list, and keys are tried in order; "+
+			"set to \"\" to authenticate only with ssh-agent")
+
+	OctopusCmd.PersistentFlags().Bool("use-agent", false,
+		"(ssh) also authenticate with the keys held by the ssh-agent at SSH_AUTH_SOCK")
+
+	OctopusCmd.PersistentFlags().Duration("connect-timeout", 30*time.Second,
+		"(ssh) time limit for connecting to each host, including the ssh handshake (e.g., 10s); "+
+			"overrides ConnectTimeout set in the ssh config file")
+	SetCmdFlagCompletion(OctopusCmd, "connect-timeout", BashCompletionEmptyCompletionFunction)
+
+	OctopusCmd.PersistentFlags().Duration("command-timeout", 0,
+		"time limit for each command run on hosts (e.g., 5m); commands which time out are killed, "+
+			"and 0 means no limit")
+	SetCmdFlagCompletion(OctopusCmd, "command-timeout", BashCompletionEmptyCompletionFunction)
+
+	OctopusCmd.PersistentFlags().String("host-key-checking", ssh.AcceptNewHostKeyChecking,
+		fmt.Sprintf("(ssh) how remote host keys are verified; one of %v", ssh.HostKeyCheckingModes))
+	SetCmdFlagCompletion(OctopusCmd, "host-key-checking", BashCompletionEmptyCompletionFunction)
+
+	OctopusCmd.PersistentFlags().StringSliceP("jump", "J", []string{},
+		"(ssh) comma-separated list of jump hosts ([user@]host[:port]) through which to connect to "+
+			"hosts, in order; overrides ProxyJump in the ssh config file")
+	SetCmdFlagCompletion(OctopusCmd, "jump", BashCompletionEmptyCompletionFunction)
+
+	OctopusCmd.PersistentFlags().StringSlice("known-hosts-file", []string{},
+		"(ssh) comma-separated list of known hosts files to use in addition to the user and global files")
 
 	OctopusCmd.PersistentFlags().Uint16P("port", "p", 22,
-		"(ssh) port on which to connect to hosts")
+		"(ssh) port on which to connect to hosts; overrides ports set in the ssh config file "+
+			"but not ports set in host group entries")
 	SetCmdFlagCompletion(OctopusCmd, "port", BashCompletionEmptyCompletionFunction)
 
+	OctopusCmd.PersistentFlags().String("output", octopus.TextFormat,
+		"same as --format; --format takes precedence if both are given")
+	SetCmdFlagCompletion(OctopusCmd, "output", BashCompletionEmptyCompletionFunction)
+
+	OctopusCmd.PersistentFlags().StringSlice("report", []string{},
+		fmt.Sprintf("comma-separated list of report files to write after all hosts finish, given as "+
+			"<kind>=<path> (e.g., junit=results.xml); kinds are %v", octopus.ReportKinds))
+
+	OctopusCmd.PersistentFlags().StringP("ssh-config", "F", "",
+		"(ssh) OpenSSH client config file from which per-host settings are read "+
+			"(default ~/.ssh/config and /etc/ssh/ssh_config); set to \"none\" to read no ssh config file")
+
+	OctopusCmd.PersistentFlags().Bool("stream", false,
+		"write each line of command output as soon as it is received, prefixed with \"<hostname>: \"")
+
+	OctopusCmd.PersistentFlags().Bool("summary", false,
+		"after all hosts finish, print a summary of succeeded, failed, unreachable, and skipped hosts "+
+			"and how long they took to stderr")
+
+	OctopusCmd.PersistentFlags().BoolP("tty", "t", false,
+		"(ssh) give each command a pseudo-terminal (like ssh \"-t\"); stdin is not sent to commands, "+
+			"and all output is stdout")
+
 	OctopusCmd.PersistentFlags().StringP("user", "u", "root",
-		"user as which to connect to hosts (corresponds to ssh \"-l\" option)")
+		"user as which to connect to hosts (corresponds to ssh \"-l\" option); "+
+			"overrides users set in the ssh config file but not users set in host group entries")
 	SetCmdFlagCompletion(OctopusCmd, "user", BashCompletionEmptyCompletionFunction)
 
 	OctopusCmd.PersistentFlags().BoolP("verbose", "v", false,
@@ -1,10 +1,13 @@
 package config
 
 import (
+	"fmt"
+	"io/ioutil"
 	"log"
 	"reflect"
 
 	"github.com/spf13/viper"
+	yaml "gopkg.in/yaml.v2"
 )
 
 // Read from the config file
@@ -23,3 +26,25 @@ func loadConfig() {
 func isConfigFileNotFoundError(err error) bool {
 	return reflect.TypeOf(err) == reflect.TypeOf(viper.ConfigFileNotFoundError{})
 }
+
+// Read the 'env' map from the config file. Viper makes the keys of maps lowercase, but environment
+// variable names are case sensitive, so the map is read from the file directly.
+func loadConfigEnv() (map[string]string, error) {
+	if !viper.InConfig("env") {
+		return map[string]string{}, nil
+	}
+	b, err := ioutil.ReadFile(viper.ConfigFileUsed())
+	if err != nil {
+		return nil, fmt.Errorf("could not read config file: %+v", err)
+	}
+	c := struct {
+		Env map[string]string `yaml:"env"`
+	}{}
+	if err := yaml.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("could not read 'env' from config file: %+v", err)
+	}
+	if c.Env == nil {
+		return map[string]string{}, nil
+	}
+	return c.Env, nil
+}
@@ -0,0 +1,30 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// InterruptedExitCode is the exit code of octopus commands which are interrupted. This is the code
+// shells use for commands killed by SIGINT.
+const InterruptedExitCode = 130
+
+// InterruptContext returns a context which is canceled when octopus receives SIGINT or SIGTERM.
+// Canceling tells the octopus to interrupt remote commands and report what results it has. If a
+// second signal is received, octopus exits right away without waiting for hosts.
+func InterruptContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-sigs
+		fmt.Fprintf(os.Stderr, "octopus received %s; interrupting hosts (signal again to exit now)\n", sig)
+		cancel()
+		<-sigs
+		os.Exit(InterruptedExitCode)
+	}()
+	return ctx
+}
@@ -2,8 +2,11 @@ package config
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"sort"
+	"strings"
 
 	"github.com/BlaineEXE/octopus/internal/logger"
 	"github.com/BlaineEXE/octopus/internal/octopus"
@@ -15,6 +18,9 @@ import (
 
 var remoteConnector remote.Connector = ssh.NewConnector()
 
+// The become password is read from this environment variable instead of asking for it if it is set.
+const becomePasswordEnvVar = "OCTOPUS_BECOME_PASSWORD"
+
 // TrainOctopus returns an octopus trained (configured) for the user's environment.
 // This sanitizes values set in the config file and on the commandline to ensure the octopus
 // is well-trained.
@@ -40,25 +46,257 @@ func TrainOctopus() (*octopus.Octopus, error) {
 	logger.Info.Println("Host groups:", hostGroups)
 
 	groupsFile := getAbsFilePath(viper.GetString("groups-file"))
-	identityFile := getAbsFilePath(viper.GetString("identity-file"))
 
-	if err := remoteConnector.AddIdentityFile(identityFile); err != nil {
-		return nil, fmt.Errorf("could not add identity file: %+v", err)
+	if err := addIdentityFiles(); err != nil {
+		return nil, err
+	}
+	if viper.GetBool("use-agent") {
+		if err := remoteConnector.UseAgent(); err != nil {
+			return nil, fmt.Errorf("could not use ssh-agent: %+v", err)
+		}
+	}
+	hostKeyChecking := viper.GetString("host-key-checking")
+	knownHostsFiles := viper.GetStringSlice("known-hosts-file")
+	logger.Info.Println("Host key checking:", hostKeyChecking, "with additional known hosts files", knownHostsFiles)
+	if err := remoteConnector.HostKeyChecking(hostKeyChecking, knownHostsFiles); err != nil {
+		return nil, fmt.Errorf("could not set host key checking: %+v", err)
+	}
+	// Only set values the user gave explicitly so that per-host settings from the ssh config file
+	// are used otherwise.
+	if isSetByUser("ssh-config") {
+		if err := remoteConnector.SSHConfigFile(viper.GetString("ssh-config")); err != nil {
+			return nil, fmt.Errorf("could not set ssh config file: %+v", err)
+		}
+	}
+	if isSetByUser("jump") {
+		jumpHosts := viper.GetStringSlice("jump")
+		logger.Info.Println("Jump hosts:", jumpHosts)
+		if err := remoteConnector.JumpHosts(jumpHosts); err != nil {
+			return nil, fmt.Errorf("could not set jump hosts: %+v", err)
+		}
+	}
+	if isSetByUser("connect-timeout") {
+		if err := remoteConnector.ConnectTimeout(viper.GetDuration("connect-timeout")); err != nil {
+			return nil, fmt.Errorf("could not set connect timeout: %+v", err)
+		}
+	}
+	if err := remoteConnector.CommandTimeout(viper.GetDuration("command-timeout")); err != nil {
+		return nil, fmt.Errorf("could not set command timeout: %+v", err)
+	}
+	tty := viper.GetBool("tty")
+	logger.Info.Println("Pseudo-terminal:", tty)
+	if err := remoteConnector.RequestTTY(tty); err != nil {
+		return nil, fmt.Errorf("could not set pseudo-terminal: %+v", err)
+	}
+	env, err := loadEnv()
+	if err != nil {
+		return nil, err
+	}
+	become, err := newBecome(env, tty)
+	if err != nil {
+		return nil, err
+	}
+	if become != nil {
+		env = map[string]string{} // become methods clear the environment, so become sets it instead
+	}
+	if err := remoteConnector.Env(env); err != nil {
+		return nil, fmt.Errorf("could not set environment variables: %+v", err)
+	}
+	if isSetByUser("port") {
+		if err := remoteConnector.Port(uint16(viper.GetInt("port"))); err != nil {
+			return nil, fmt.Errorf("could not change port: %+v", err) // ssh always return nil here
+		}
+	}
+	if isSetByUser("user") {
+		if err := remoteConnector.User(viper.GetString("user")); err != nil {
+			return nil, fmt.Errorf("could not change user: %+v", err) // ssh always return nil here
+		}
+	}
+
+	fanout := uint(viper.GetInt("fanout"))
+	logger.Info.Println("Fanout:", fanout)
+	batch, err := octopus.ParseBatch(viper.GetString("batch"))
+	if err != nil {
+		return nil, fmt.Errorf("could not set batch size: %+v", err)
+	}
+	batchPause := viper.GetDuration("batch-pause")
+	maxFailures := viper.GetInt("max-failures")
+	logger.Info.Println("Batch size:", batch, "with pause", batchPause, "and max failures", maxFailures)
+	reporter, err := newReporter()
+	if err != nil {
+		return nil, err
 	}
-	if err := remoteConnector.Port(uint16(viper.GetInt("port"))); err != nil {
-		return nil, fmt.Errorf("could not change port: %+v", err) // ssh always return nil here
+	// output-dir is only a flag for commands which produce output
+	outputDir := viper.GetString("output-dir")
+	if outputDir != "" {
+		outputDir = getAbsFilePath(outputDir)
 	}
-	if err := remoteConnector.User(viper.GetString("user")); err != nil {
-		return nil, fmt.Errorf("could not change user: %+v", err) // ssh always return nil here
+	logger.Info.Println("Output dir:", outputDir)
+	summary := viper.GetBool("summary")
+	logger.Info.Println("Summary:", summary)
+	reports := []octopus.Report{}
+	for _, s := range viper.GetStringSlice("report") {
+		r, err := octopus.ParseReport(s)
+		if err != nil {
+			return nil, fmt.Errorf("could not set report: %+v", err)
+		}
+		reports = append(reports, r)
 	}
+	logger.Info.Println("Reports:", reports)
+
+	// like ssh, send stdin to hosts unless it is a terminal or the user doesn't want it to be.
+	// Commands with a pseudo-terminal read from the terminal, which never ends their input.
+	var stdin io.Reader
+	if !viper.GetBool("no-stdin") && !tty && !isTerminal(os.Stdin) {
+		stdin = os.Stdin
+	}
+	logger.Info.Println("Send stdin:", stdin != nil)
 
 	return octopus.New(
 		remoteConnector,
 		hostGroups,
 		groupsFile,
+		octopus.NewOptions(
+			fanout, batch, batchPause, maxFailures, reporter, outputDir, summary, reports, stdin,
+			become),
 	), nil
 }
 
+// Create the reporter for the user's format. The 'output' option is used if 'format' is not set,
+// and '--stream' and '--collate' are shorthand for the stream and collate formats.
+func newReporter() (octopus.Reporter, error) {
+	format := viper.GetString("format")
+	if isSetByUser("output") && !isSetByUser("format") {
+		format = viper.GetString("output")
+	}
+	stream := viper.GetBool("stream")
+	// collate is only a flag for commands which produce output
+	collate := viper.GetBool("collate")
+	if stream && collate {
+		return nil, fmt.Errorf("cannot both stream and collate output")
+	}
+	if stream || collate {
+		want := octopus.StreamFormat
+		if collate {
+			want = octopus.CollateFormat
+		}
+		if format != octopus.TextFormat && format != want {
+			return nil, fmt.Errorf("cannot stream or collate output in %s format", format)
+		}
+		format = want
+	}
+	logger.Info.Println("Format:", format)
+	reporter, err := octopus.NewReporter(format, os.Stdout, os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("could not set format: %+v", err)
+	}
+	return reporter, nil
+}
+
+// Load environment variables from the config file's 'env' map and from '--env' flags, which take
+// precedence. Only variable names are logged since values may be secret.
+func loadEnv() (map[string]string, error) {
+	env, err := loadConfigEnv()
+	if err != nil {
+		return nil, err
+	}
+	flagEnv, err := OctopusCmd.PersistentFlags().GetStringArray("env")
+	if err != nil {
+		return nil, err
+	}
+	for _, kv := range flagEnv {
+		s := strings.SplitN(kv, "=", 2)
+		if len(s) != 2 {
+			return nil, fmt.Errorf("environment variable %q is not of the form KEY=VALUE", kv)
+		}
+		env[s[0]] = s[1]
+	}
+	names := []string{}
+	for n := range env {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	logger.Info.Println("Environment variables:", names)
+	return env, nil
+}
+
+// Create the definition of how commands become root if the user wants them to, or return nil. The
+// password is only asked for if the user wants to give one. su and doas read passwords from the
+// terminal, so commands must have one to be given a password.
+func newBecome(env map[string]string, tty bool) (*octopus.Become, error) {
+	if !viper.GetBool("become") {
+		return nil, nil
+	}
+	method := viper.GetString("become-method")
+	askPass := viper.GetBool("ask-become-pass")
+	logger.Info.Println("Become method:", method, "with password:", askPass)
+	var password []byte
+	if askPass {
+		// check the method before asking for a password which would go unused
+		switch method {
+		case octopus.SudoBecome:
+		case octopus.SuBecome, octopus.DoasBecome:
+			if !tty {
+				return nil, fmt.Errorf("could not set become: become method %s reads the password "+
+					"from a terminal, so commands need '--tty'", method)
+			}
+		default:
+			return nil, fmt.Errorf("could not set become: become method %q is not one of %v",
+				method, octopus.BecomeMethods)
+		}
+		p, err := util.ReadSecret(becomePasswordEnvVar, method+" password: ")
+		if err != nil {
+			return nil, fmt.Errorf("could not get become password: %+v", err)
+		}
+		password = p
+	}
+	b, err := octopus.NewBecome(method, password, env)
+	if err != nil {
+		return nil, fmt.Errorf("could not set become: %+v", err)
+	}
+	return b, nil
+}
+
+// Add all identity files to the connector in order. An empty list of identity files means that the
+// user only wants to authenticate with ssh-agent.
+func addIdentityFiles() error {
+	identityFiles := viper.GetStringSlice("identity-file")
+	usingDefaults := !isSetByUser("identity-file")
+	logger.Info.Println("Identity files:", identityFiles)
+
+	for _, f := range identityFiles {
+		if f == "" {
+			continue
+		}
+		p := getAbsFilePath(f)
+		if _, err := os.Stat(p); usingDefaults && os.IsNotExist(err) {
+			logger.Warning.Println("skipping default identity file which does not exist:", p)
+			continue
+		}
+		if err := remoteConnector.AddIdentityFile(p); err != nil {
+			return fmt.Errorf("could not add identity file: %+v", err)
+		}
+	}
+	return nil
+}
+
+// isSetByUser returns true if the user set the option on the commandline or in the config file.
+func isSetByUser(key string) bool {
+	if f := OctopusCmd.PersistentFlags().Lookup(key); f != nil && f.Changed {
+		return true
+	}
+	return viper.InConfig(key)
+}
+
+// isTerminal returns true if the file is a terminal (or another character device, like /dev/null).
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return true // can't read from it anyway
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
 func getAbsFilePath(path string) string {
 	a, err := util.AbsPath(path)
 	if err != nil {
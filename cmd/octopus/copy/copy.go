@@ -6,6 +6,7 @@ import (
 
 	"github.com/BlaineEXE/octopus/cmd/octopus/config"
 	"github.com/BlaineEXE/octopus/internal/logger"
+	"github.com/BlaineEXE/octopus/internal/octopus"
 	"github.com/BlaineEXE/octopus/internal/ssh"
 	"github.com/BlaineEXE/octopus/internal/tentacle"
 	"github.com/spf13/cobra"
@@ -53,7 +54,10 @@ var CopyCmd = &cobra.Command{
 		logger.Info.Println("SFTP requests per file:", ssh.UserSFTPOptions.RequestsPerFile)
 
 		opts := tentacle.NewCopyFileOptions(viper.GetBool("recursive"))
-		numErrs, err := o.Do(tentacle.FileCopier(localSources, remoteDir, opts))
+		numErrs, err := o.Do(config.InterruptContext(), tentacle.FileCopier(localSources, remoteDir, opts))
+		if err == octopus.ErrInterrupted {
+			os.Exit(config.InterruptedExitCode)
+		}
 		if err != nil {
 			return fmt.Errorf("octopus copy files failure: %+v", err)
 		}
@@ -5,6 +5,7 @@ package hostgroups
 import (
 	"fmt"
 	"log"
+	"os"
 
 	"github.com/BlaineEXE/octopus/internal/octopus"
 	"github.com/BlaineEXE/octopus/internal/util"
@@ -27,6 +28,8 @@ var HostGroupsCommand = &cobra.Command{
 			nil,
 			[]string{},
 			getAbsFilePath(viper.GetString("groups-file")),
+			octopus.NewOptions(0, octopus.Batch{}, 0, -1,
+				octopus.NewTextReporter(os.Stdout, os.Stderr), "", false, nil, nil, nil),
 		)
 
 		gs, err := o.ValidHostGroups()
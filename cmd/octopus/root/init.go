@@ -6,6 +6,7 @@ import (
 	"github.com/BlaineEXE/octopus/cmd/octopus/copy"
 	"github.com/BlaineEXE/octopus/cmd/octopus/hostgroups"
 	"github.com/BlaineEXE/octopus/cmd/octopus/run"
+	"github.com/BlaineEXE/octopus/cmd/octopus/script"
 	"github.com/BlaineEXE/octopus/cmd/octopus/version"
 )
 
@@ -18,4 +19,5 @@ func init() {
 	octopusCmd.AddCommand(hostgroups.HostGroupsCommand)
 	octopusCmd.AddCommand(run.RunCmd)
 	octopusCmd.AddCommand(copy.CopyCmd)
+	octopusCmd.AddCommand(script.ScriptCmd)
 }
@@ -5,21 +5,44 @@ import (
 	"os"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 
 	"github.com/BlaineEXE/octopus/cmd/octopus/config"
 	"github.com/BlaineEXE/octopus/internal/logger"
+	"github.com/BlaineEXE/octopus/internal/octopus"
 	"github.com/BlaineEXE/octopus/internal/tentacle"
 )
 
 const (
 	aboutText = "Run the given command on remote hosts."
+
+	templateText = `
+  Command templates:
+    With '--template', the command is a Go text/template which is rendered
+    for each host before it is run, e.g., 'ceph-osd -i {{.Index}}' or
+    'hostnamectl set-hostname {{.Attrs.name}}'. The variables are:
+      .Host     the host entry as given in the host groups file without
+                attributes, e.g., admin@10.0.0.5:2222
+      .Address  the host's address without user or port
+      .User     the user given in the host entry, if any
+      .Port     the port given in the host entry, or 0
+      .Group    the host group in which the host's entry is
+      .Groups   all of the host groups being operated on which have the host
+      .Index    the index of the host's entry within its group, from 0
+      .Attrs    attributes given in the host entry, e.g., for the entry
+                '10.0.0.5,rack=r1,osd=3', {{.Attrs.rack}} is 'r1'
+      .Name     the hostname reported by the host (also .Hostname)
+    Using an attribute which a host does not have is an error for that host.
+    With '--dry-run', the command which would be run on each host is output
+    instead of being run. Hosts are not connected to unless the template uses
+    .Name or .Hostname, which are only known once hosts are connected to.`
 )
 
 // RunCmd is the 'run' command definition which runs a command on remote hosts.
 var RunCmd = &cobra.Command{
 	Use:   "run [flags] <COMMAND>",
 	Short: aboutText,
-	Long:  fmt.Sprintf("\n%s", aboutText),
+	Long:  fmt.Sprintf("\n%s\n%s", aboutText, templateText),
 	// Octopus could support more than one arg here and use all args as one command string, but this
 	// is to prevent users from being able  to accidentally shoot themselves in the foot with pipes.
 	// You must surround your command in quotes to run a command with pipes on remote hosts,
@@ -34,7 +57,21 @@ var RunCmd = &cobra.Command{
 			return err
 		}
 
-		numErrs, err := o.Do(tentacle.CommandRunner(args[0]))
+		opts := tentacle.NewRunCommandOptions(viper.GetBool("template"), viper.GetBool("dry-run"))
+		action, err := tentacle.CommandRunner(args[0], opts)
+		if err != nil {
+			return err
+		}
+
+		do := o.Do
+		if !tentacle.NeedsConnection(args[0], opts) {
+			logger.Info.Println("Dry run without connecting to hosts")
+			do = o.DoWithoutConnecting
+		}
+		numErrs, err := do(config.InterruptContext(), action)
+		if err == octopus.ErrInterrupted {
+			os.Exit(config.InterruptedExitCode)
+		}
 		if err != nil {
 			return fmt.Errorf("octopus run command failure: %+v", err)
 		}
@@ -42,3 +79,21 @@ var RunCmd = &cobra.Command{
 		return nil
 	},
 }
+
+func init() {
+	RunCmd.Flags().BoolP("collate", "c", false,
+		"print identical output once for all hosts which have it, headed by a compact host list "+
+			"(e.g., node[01-40,42]), like dshbak -c")
+
+	RunCmd.Flags().String("output-dir", "",
+		"dir in which to write each host's output to <hostname>.stdout and <hostname>.stderr and a "+
+			"summary to <hostname>.status, in addition to the output format (see --format none)")
+
+	RunCmd.Flags().Bool("template", false,
+		"render the command as a Go text/template for each host (e.g., 'ceph-osd -i {{.Index}}')")
+
+	RunCmd.Flags().Bool("dry-run", false,
+		"output the command which would be run on each host instead of running it")
+
+	viper.BindPFlags(RunCmd.Flags())
+}
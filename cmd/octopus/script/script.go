@@ -0,0 +1,73 @@
+package script
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/BlaineEXE/octopus/cmd/octopus/config"
+	"github.com/BlaineEXE/octopus/internal/logger"
+	"github.com/BlaineEXE/octopus/internal/octopus"
+	"github.com/BlaineEXE/octopus/internal/tentacle"
+)
+
+// ScriptCmd is the 'script' command definition which runs a local script on remote hosts.
+var ScriptCmd = &cobra.Command{
+	Use:   "script [flags] LOCAL_SCRIPT [ARGS...]",
+	Short: "Run a local script on remote hosts.",
+	Long: `
+  Copy a local script to a new temporary dir on remote hosts, run it there with
+  the given args, and delete it afterwards. The script is deleted even if it
+  fails. This avoids having to quote multi-line logic for 'octopus run'.
+
+  The script is run directly, so it should begin with a shebang line (e.g.,
+  '#!/usr/bin/env bash'), unless '--interpreter' is given. The interpreter is
+  run with the script's remote path as its first argument and may include its
+  own arguments (e.g., 'bash -x' or 'python3 -u').
+
+  All arguments after the script are passed to the script, even ones which
+  look like flags, so Octopus's flags must be given before the script.
+
+  The script is copied with SSH's SFTP subsystem; see 'octopus copy --help'.
+`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		script, scriptArgs := args[0], args[1:]
+		interpreter := viper.GetString("interpreter")
+		logger.Info.Println("running script", script, "with args", scriptArgs, "and interpreter", interpreter)
+
+		action, err := tentacle.ScriptRunner(script, scriptArgs, tentacle.NewRunScriptOptions(interpreter))
+		if err != nil {
+			return err
+		}
+
+		o, err := config.TrainOctopus()
+		if err != nil {
+			return err
+		}
+
+		numErrs, err := o.Do(config.InterruptContext(), action)
+		if err == octopus.ErrInterrupted {
+			os.Exit(config.InterruptedExitCode)
+		}
+		if err != nil {
+			return fmt.Errorf("octopus run script failure: %+v", err)
+		}
+		os.Exit(numErrs)
+		return nil
+	},
+}
+
+func init() {
+	// args after the script are the script's own
+	ScriptCmd.Flags().SetInterspersed(false)
+
+	ScriptCmd.Flags().String("interpreter", "",
+		"command with which to run the script on remote hosts (e.g., python3); "+
+			"by default, the script is run directly")
+	config.SetCmdFlagCompletion(ScriptCmd, "interpreter", config.BashCompletionEmptyCompletionFunction)
+
+	viper.BindPFlags(ScriptCmd.Flags())
+}
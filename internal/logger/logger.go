@@ -4,13 +4,18 @@ package logger
 import (
 	"io/ioutil"
 	"log"
+	"os"
 )
 
 var (
 	// Info is the logger used for debug printing
 	Info *log.Logger
+
+	// Warning is the logger used for reporting potential problems to the user
+	Warning *log.Logger
 )
 
 func init() {
 	Info = log.New(ioutil.Discard, "INFO: ", 0) // Don't output info messages by default
+	Warning = log.New(os.Stderr, "WARNING: ", 0)
 }
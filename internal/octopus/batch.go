@@ -0,0 +1,71 @@
+package octopus
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/BlaineEXE/octopus/internal/remote"
+)
+
+// A Batch is the number of hosts which an octopus operates on before moving on to the next hosts.
+// The zero value means all hosts are operated on in a single batch.
+type Batch struct {
+	size    uint
+	percent bool // size is a percentage of all hosts
+}
+
+// ParseBatch parses a batch size given as a number of hosts (e.g., "10") or as a percentage of all
+// hosts (e.g., "25%"). An empty string or "0" means all hosts are in a single batch.
+func ParseBatch(s string) (Batch, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Batch{}, nil
+	}
+	b := Batch{}
+	if strings.HasSuffix(s, "%") {
+		b.percent = true
+		s = strings.TrimSuffix(s, "%")
+	}
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return Batch{}, fmt.Errorf("batch size %q is not a number of hosts or a percentage. %+v", s, err)
+	}
+	if b.percent && (n == 0 || n > 100) {
+		return Batch{}, fmt.Errorf("batch percentage %d%% is not between 1%% and 100%%", n)
+	}
+	b.size = uint(n)
+	return b, nil
+}
+
+func (b Batch) String() string {
+	switch {
+	case b.size == 0:
+		return "all hosts"
+	case b.percent:
+		return fmt.Sprintf("%d%%", b.size)
+	default:
+		return fmt.Sprintf("%d", b.size)
+	}
+}
+
+// split the hosts into batches. Percentages are rounded up so that every batch has at least one host.
+func (b Batch) split(hosts []*remote.HostInfo) [][]*remote.HostInfo {
+	size := int(b.size)
+	if b.percent {
+		size = (len(hosts)*int(b.size) + 99) / 100
+	}
+	if size <= 0 || size > len(hosts) {
+		size = len(hosts)
+	}
+
+	batches := [][]*remote.HostInfo{}
+	for len(hosts) > 0 {
+		if size > len(hosts) {
+			size = len(hosts)
+		}
+		batches = append(batches, hosts[:size])
+		hosts = hosts[size:]
+	}
+	return batches
+}
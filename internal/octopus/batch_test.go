@@ -0,0 +1,84 @@
+package octopus
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/BlaineEXE/octopus/internal/remote"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseBatch(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    Batch
+		wantErr bool
+	}{
+		{"", Batch{}, false},
+		{"0", Batch{}, false},
+		{"10", Batch{10, false}, false},
+		{"25%", Batch{25, true}, false},
+		{"100%", Batch{100, true}, false},
+		{"0%", Batch{}, true},
+		{"101%", Batch{}, true},
+		{"-1", Batch{}, true},
+		{"ten", Batch{}, true},
+		{"%", Batch{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := ParseBatch(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseBatch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestBatch_split(t *testing.T) {
+	hosts := func(n int) []*remote.HostInfo {
+		h := []*remote.HostInfo{}
+		for i := 0; i < n; i++ {
+			h = append(h, &remote.HostInfo{Host: remote.Host{Address: fmt.Sprintf("host%d", i)}})
+		}
+		return h
+	}
+	sizes := func(batches [][]*remote.HostInfo) []int {
+		s := []int{}
+		for _, b := range batches {
+			s = append(s, len(b))
+		}
+		return s
+	}
+
+	tests := []struct {
+		name      string
+		batch     Batch
+		numHosts  int
+		wantSizes []int
+	}{
+		{"all hosts", Batch{}, 10, []int{10}},
+		{"even batches", Batch{5, false}, 10, []int{5, 5}},
+		{"uneven batches", Batch{3, false}, 10, []int{3, 3, 3, 1}},
+		{"batch larger than hosts", Batch{20, false}, 10, []int{10}},
+		{"percent", Batch{25, true}, 8, []int{2, 2, 2, 2}},
+		{"percent rounds up", Batch{25, true}, 10, []int{3, 3, 3, 1}},
+		{"small percent has at least one host", Batch{1, true}, 3, []int{1, 1, 1}},
+		{"100 percent", Batch{100, true}, 10, []int{10}},
+		{"no hosts", Batch{3, false}, 0, []int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := hosts(tt.numHosts)
+			got := tt.batch.split(h)
+			assert.Equal(t, tt.wantSizes, sizes(got))
+			// hosts should stay in order
+			all := []*remote.HostInfo{}
+			for _, b := range got {
+				all = append(all, b...)
+			}
+			assert.Equal(t, h, all)
+		})
+	}
+}
@@ -0,0 +1,379 @@
+package octopus
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/BlaineEXE/octopus/internal/logger"
+	"github.com/BlaineEXE/octopus/internal/remote"
+	"github.com/BlaineEXE/octopus/internal/util"
+)
+
+// Methods with which commands become root on hosts
+const (
+	SudoBecome = "sudo"
+	SuBecome   = "su"
+	DoasBecome = "doas"
+)
+
+// BecomeMethods are the methods with which commands can become root on hosts.
+var BecomeMethods = []string{SudoBecome, SuBecome, DoasBecome}
+
+// sudo is given this prompt so that it can be found and removed from output. su and doas prompts
+// can't be set, so they are found by looking for output ending in "password:".
+const sudoPrompt = "[octopus] become password: "
+
+var (
+	sudoPromptRegexp  = regexp.MustCompile(regexp.QuoteMeta(sudoPrompt) + "$")
+	otherPromptRegexp = regexp.MustCompile(`(?i)[^\n]*password[^\n]*: ?$`)
+)
+
+// Become defines how commands become root on hosts.
+type Become struct {
+	method       string
+	password     []byte // nil if commands shouldn't be given a password
+	env          map[string]string
+	marker       string // printed by commands once they have become root
+	promptRegexp *regexp.Regexp
+}
+
+// NewBecome creates a definition of how commands become root on hosts. The method must be one of
+// BecomeMethods. If the password is nil, commands fail instead of asking for a password when one
+// is needed. su can't be told not to ask, so it must be given a password. Environment variables are
+// set for commands after they have become root since become methods usually clear the environment.
+func NewBecome(method string, password []byte, env map[string]string) (*Become, error) {
+	b := &Become{
+		method:       method,
+		password:     password,
+		env:          env,
+		promptRegexp: otherPromptRegexp,
+	}
+	switch method {
+	case SudoBecome:
+		b.promptRegexp = sudoPromptRegexp
+	case SuBecome:
+		if password == nil {
+			return nil, fmt.Errorf("become method %s always asks for a password, so it needs one", method)
+		}
+	case DoasBecome:
+	default:
+		return nil, fmt.Errorf("become method %q is not one of %v", method, BecomeMethods)
+	}
+	r := make([]byte, 8)
+	if _, err := rand.Read(r); err != nil {
+		return nil, fmt.Errorf("failed to create become success marker. %+v", err)
+	}
+	b.marker = "OCTOPUS-BECOME-SUCCESS-" + hex.EncodeToString(r)
+	return b, nil
+}
+
+// wrap the command so that it is run as root
+func (b *Become) wrap(command string) string {
+	names := make([]string, 0, len(b.env))
+	for n := range b.env {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	if len(names) > 0 {
+		exports := make([]string, 0, len(names))
+		for _, n := range names {
+			exports = append(exports, n+"="+util.ShellQuote(b.env[n]))
+		}
+		command = "export " + strings.Join(exports, " ") + "; " + command
+	}
+	if b.password != nil {
+		// the marker tells when the password has been accepted and stdin is the command's
+		command = "echo " + b.marker + "; " + command
+	}
+
+	script := util.ShellQuote(command)
+	switch b.method {
+	case SudoBecome:
+		if b.password == nil {
+			return "sudo -n -- sh -c " + script
+		}
+		return "sudo -S -p " + util.ShellQuote(sudoPrompt) + " -- sh -c " + script
+	case SuBecome:
+		// su is always given a password
+		return "su -c " + script + " root"
+	default:
+		if b.password == nil {
+			return "doas -n -- sh -c " + script
+		}
+		return "doas -- sh -c " + script
+	}
+}
+
+// A becomeActor runs commands as root and copies files to where only root can write. Files are
+// copied to a staging dir as the login user and then moved into place as root. Other actor tasks
+// are done by the wrapped actor.
+type becomeActor struct {
+	remote.Actor
+	become *Become
+
+	stageOnce sync.Once
+	stageDir  string
+	stageErr  error
+	staged    uint64 // number of files staged; used to name staged files
+}
+
+func newBecomeActor(a remote.Actor, b *Become) *becomeActor {
+	return &becomeActor{
+		Actor:  a,
+		become: b,
+	}
+}
+
+func (a *becomeActor) RunCommand(command string) (stdout, stderr *bytes.Buffer, err error) {
+	stdout = new(bytes.Buffer)
+	stderr = new(bytes.Buffer)
+	err = a.StreamCommand(&remote.Command{Command: command, Stdout: stdout, Stderr: stderr})
+	return
+}
+
+// StreamCommand runs the command as root. If there is a password, it is sent each time the become
+// method asks for it, and the command's stdin is only sent once the command has become root. The
+// password prompt and success marker are removed from the command's output.
+func (a *becomeActor) StreamCommand(c *remote.Command) error {
+	b := a.become
+	wrapped := *c
+	wrapped.Command = b.wrap(c.Command)
+	if b.password == nil {
+		return a.Actor.StreamCommand(&wrapped)
+	}
+
+	s := &becomeSession{events: make(chan becomeEvent, 4), done: make(chan struct{})}
+	stdout := &becomeFilter{w: c.Stdout, session: s, prompt: b.promptRegexp, marker: []byte(b.marker + "\n")}
+	stderr := &becomeFilter{w: c.Stderr, session: s, prompt: b.promptRegexp, marker: []byte(b.marker + "\n")}
+	r, w := io.Pipe()
+	go s.sendStdin(w, b.password, c.Stdin)
+	wrapped.Stdout, wrapped.Stderr, wrapped.Stdin = stdout, stderr, r
+
+	err := a.Actor.StreamCommand(&wrapped)
+	close(s.done)
+	r.Close() // stop sending stdin if the command finishes without reading all of it
+	stdout.Flush()
+	stderr.Flush()
+	return err
+}
+
+// CreateRemoteDir creates the dir and any nonexistent parents as root. Like other actors, a dir
+// which already exists is left as it is.
+func (a *becomeActor) CreateRemoteDir(dirPath string, perms os.FileMode) error {
+	d := util.ShellQuote(dirPath)
+	cmd := fmt.Sprintf("[ -d %s ] || { mkdir -p %s && chmod %o %s; }", d, d, perms.Perm(), d)
+	if err := a.runQuietly(cmd); err != nil {
+		return fmt.Errorf("failed to create remote dir %s. %+v", dirPath, err)
+	}
+	return nil
+}
+
+// CopyFileToRemote copies the file to the staging dir as the login user and then moves it to the
+// remote path as root. The moved file is owned by root, and its mode and modification time are
+// kept.
+func (a *becomeActor) CopyFileToRemote(localSource *os.File, remoteFilePath string, info os.FileInfo) error {
+	dir, err := a.makeStageDir()
+	if err != nil {
+		return err
+	}
+	staged := path.Join(dir, strconv.FormatUint(atomic.AddUint64(&a.staged, 1), 10))
+	if err := a.Actor.CopyFileToRemote(localSource, staged, info); err != nil {
+		return err
+	}
+	s, d := util.ShellQuote(staged), util.ShellQuote(remoteFilePath)
+	cmd := fmt.Sprintf(`mv -f %s %s && chown "$(id -u):$(id -g)" %s`, s, d, d)
+	if err := a.runQuietly(cmd); err != nil {
+		return fmt.Errorf("failed to move staged file %s to %s. %+v", staged, remoteFilePath, err)
+	}
+	return nil
+}
+
+// the staging dir is only made once a file is copied and is made as the login user
+func (a *becomeActor) makeStageDir() (string, error) {
+	a.stageOnce.Do(func() {
+		o, e, err := a.Actor.RunCommand(`mktemp -d "${TMPDIR:-/tmp}/octopus-become.XXXXXXXXXX"`)
+		a.stageDir = strings.TrimSpace(o.String())
+		if err == nil && a.stageDir == "" {
+			err = fmt.Errorf("no dir was reported")
+		}
+		if err != nil {
+			a.stageErr = fmt.Errorf("failed to create staging dir for copying files on remote host. %+v: %s",
+				err, strings.TrimSpace(e.String()))
+		}
+	})
+	return a.stageDir, a.stageErr
+}
+
+// remove the staging dir if one was made, even if octopus has been interrupted
+func (a *becomeActor) cleanUp() {
+	if a.stageDir == "" || a.stageErr != nil {
+		return
+	}
+	e := new(bytes.Buffer)
+	cmd := &remote.Command{
+		Command: "rm -rf " + util.ShellQuote(a.stageDir),
+		Stdout:  ioutil.Discard,
+		Stderr:  e,
+		Cleanup: true,
+	}
+	if err := a.Actor.StreamCommand(cmd); err != nil {
+		logger.Warning.Printf("failed to remove staging dir %s on remote host. %+v: %s",
+			a.stageDir, err, strings.TrimSpace(e.String()))
+	}
+}
+
+func (a *becomeActor) runQuietly(command string) error {
+	_, e, err := a.RunCommand(command)
+	if err != nil {
+		return fmt.Errorf("%+v: %s", err, strings.TrimSpace(e.String()))
+	}
+	return nil
+}
+
+type becomeEvent int
+
+const (
+	becomePrompted  becomeEvent = iota // the become method asked for the password
+	becomeSucceeded                    // the command has become root
+)
+
+// A becomeSession tracks a single command becoming root.
+type becomeSession struct {
+	events    chan becomeEvent
+	done      chan struct{} // closed when the command is done
+	lock      sync.Mutex
+	succeeded bool
+}
+
+// report an event without waiting if no more events are wanted
+func (s *becomeSession) report(e becomeEvent) {
+	if e == becomeSucceeded {
+		s.lock.Lock()
+		s.succeeded = true
+		s.lock.Unlock()
+	}
+	select {
+	case s.events <- e:
+	default:
+	}
+}
+
+func (s *becomeSession) hasSucceeded() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.succeeded
+}
+
+// Send the password when it is asked for, and send stdin once the command has become root. If the
+// password is asked for again, it was wrong, and an empty line is sent instead so that the become
+// method gives up rather than waiting.
+func (s *becomeSession) sendStdin(w *io.PipeWriter, password []byte, stdin io.Reader) {
+	defer w.Close()
+	prompted := false
+	for {
+		select {
+		case e := <-s.events:
+			if e == becomeSucceeded {
+				if stdin != nil {
+					io.Copy(w, stdin)
+				}
+				return
+			}
+			if prompted {
+				w.Write([]byte("\n"))
+				return
+			}
+			prompted = true
+			w.Write(password)
+			w.Write([]byte("\n"))
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// A becomeFilter removes password prompts and the success marker from a command's output until the
+// command has become root. Output which could be the start of a prompt or of the marker is held
+// back until more output shows what it is or until the filter is flushed.
+type becomeFilter struct {
+	w       io.Writer
+	session *becomeSession
+	prompt  *regexp.Regexp
+	marker  []byte // the marker line, including its newline
+	held    []byte
+	// the newline written after the password is entered (which isn't echoed) is removed too
+	skipNewline bool
+}
+
+func (f *becomeFilter) Write(p []byte) (int, error) {
+	if len(f.held) == 0 && !f.skipNewline && f.session.hasSucceeded() {
+		return f.w.Write(p)
+	}
+	f.held = append(f.held, p...)
+	if err := f.filter(); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (f *becomeFilter) filter() error {
+	for len(f.held) > 0 {
+		if f.skipNewline {
+			f.skipNewline = false
+			if f.held[0] == '\n' {
+				f.held = f.held[1:]
+				continue
+			}
+		}
+		if f.session.hasSucceeded() {
+			break
+		}
+		if i := bytes.Index(f.held, f.marker); i >= 0 {
+			if err := f.write(i); err != nil {
+				return err
+			}
+			f.held = f.held[len(f.marker):]
+			f.session.report(becomeSucceeded)
+			continue
+		}
+		if loc := f.prompt.FindIndex(f.held); loc != nil {
+			if err := f.write(loc[0]); err != nil {
+				return err
+			}
+			f.held = f.held[loc[1]-loc[0]:]
+			f.skipNewline = true
+			f.session.report(becomePrompted)
+			continue
+		}
+		// whole lines can't be the start of a prompt or the marker
+		return f.write(bytes.LastIndexByte(f.held, '\n') + 1)
+	}
+	return f.write(len(f.held))
+}
+
+// write the first n held bytes
+func (f *becomeFilter) write(n int) error {
+	if n == 0 {
+		return nil
+	}
+	_, err := f.w.Write(f.held[:n])
+	f.held = f.held[n:]
+	return err
+}
+
+// Flush writes all output which is being held back.
+func (f *becomeFilter) Flush() error {
+	return f.write(len(f.held))
+}
@@ -0,0 +1,275 @@
+package octopus
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/BlaineEXE/octopus/internal/remote"
+	remotetest "github.com/BlaineEXE/octopus/internal/remote/test"
+	"github.com/BlaineEXE/octopus/internal/util/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBecome_wrap(t *testing.T) {
+	env := map[string]string{"VERSION": "1.2", "HTTP_PROXY": "http://proxy:3128"}
+	tests := []struct {
+		name     string
+		method   string
+		password []byte
+		env      map[string]string
+		want     string
+	}{
+		{"sudo", SudoBecome, nil, nil, `sudo -n -- sh -c 'cat /etc/shadow'`},
+		{"sudo with password", SudoBecome, []byte("secret"), nil,
+			`sudo -S -p '[octopus] become password: ' -- sh -c 'echo MARKER; cat /etc/shadow'`},
+		{"sudo with env", SudoBecome, nil, env,
+			`sudo -n -- sh -c 'export HTTP_PROXY='\''http://proxy:3128'\'' VERSION='\''1.2'\''; cat /etc/shadow'`},
+		{"su with password", SuBecome, []byte("secret"), nil, `su -c 'echo MARKER; cat /etc/shadow' root`},
+		{"doas", DoasBecome, nil, nil, `doas -n -- sh -c 'cat /etc/shadow'`},
+		{"doas with password", DoasBecome, []byte("secret"), nil,
+			`doas -- sh -c 'echo MARKER; cat /etc/shadow'`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := NewBecome(tt.method, tt.password, tt.env)
+			assert.NoError(t, err)
+			assert.Regexp(t, "^OCTOPUS-BECOME-SUCCESS-[0-9a-f]{16}$", b.marker)
+			got := strings.Replace(b.wrap("cat /etc/shadow"), b.marker, "MARKER", 1)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err := NewBecome("pkexec", nil, nil)
+	assert.Error(t, err)
+	// su would ask for a password which it can't be given
+	_, err = NewBecome(SuBecome, nil, nil)
+	assert.Error(t, err)
+}
+
+func Test_becomeFilter(t *testing.T) {
+	marker := "OCTOPUS-BECOME-SUCCESS-0\n"
+	tests := []struct {
+		name        string
+		prompt      *regexp.Regexp
+		writes      []string
+		want        string
+		wantEvents  []becomeEvent
+		wantSucceed bool
+	}{
+		{"plain output", sudoPromptRegexp, []string{"a\nb", "c\n"}, "a\nbc\n", []becomeEvent{}, false},
+		{"no password needed", sudoPromptRegexp, []string{marker + "root\n"}, "root\n",
+			[]becomeEvent{becomeSucceeded}, true},
+		{"sudo prompt", sudoPromptRegexp, []string{sudoPrompt, marker, "root\n"}, "root\n",
+			[]becomeEvent{becomePrompted, becomeSucceeded}, true},
+		{"wrong password", sudoPromptRegexp,
+			[]string{"[octopus] become ", "password: ", "Sorry, try again.\n", sudoPrompt},
+			"Sorry, try again.\n", []becomeEvent{becomePrompted, becomePrompted}, false},
+		{"su prompt on a terminal", otherPromptRegexp, []string{"Password: ", "\n" + marker + "root\n"},
+			"root\n", []becomeEvent{becomePrompted, becomeSucceeded}, true},
+		{"doas prompt", otherPromptRegexp, []string{"doas (user@host) password: ", marker, "root\n"},
+			"root\n", []becomeEvent{becomePrompted, becomeSucceeded}, true},
+		{"marker split across writes", otherPromptRegexp, []string{"OCTOPUS-BECOME", "-SUCCESS-0\nroot\n"},
+			"root\n", []becomeEvent{becomeSucceeded}, true},
+		{"failure", otherPromptRegexp, []string{"Password: ", "\nsu: Authentication failure\n"},
+			"su: Authentication failure\n", []becomeEvent{becomePrompted}, false},
+		{"prompts are not removed after success", otherPromptRegexp, []string{marker, "New password: "},
+			"New password: ", []becomeEvent{becomeSucceeded}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &becomeSession{events: make(chan becomeEvent, 4), done: make(chan struct{})}
+			b := new(bytes.Buffer)
+			f := &becomeFilter{w: b, session: s, prompt: tt.prompt, marker: []byte(marker)}
+			for _, w := range tt.writes {
+				n, err := f.Write([]byte(w))
+				assert.NoError(t, err)
+				assert.Equal(t, len(w), n)
+			}
+			assert.NoError(t, f.Flush())
+			assert.Equal(t, tt.want, b.String())
+			close(s.events)
+			events := []becomeEvent{}
+			for e := range s.events {
+				events = append(events, e)
+			}
+			assert.Equal(t, tt.wantEvents, events)
+			assert.Equal(t, tt.wantSucceed, s.hasSucceeded())
+		})
+	}
+}
+
+// A becomeHost is an actor on a host where sudo asks for the password "secret" up to 3 times if a
+// password is needed. Commands which succeed output "ran" and then their stdin.
+type becomeHost struct {
+	remote.Actor  // other methods are not implemented
+	needsPassword bool
+
+	lock     sync.Mutex
+	commands []string
+	copies   []string
+}
+
+var markerRegexp = regexp.MustCompile(`OCTOPUS-BECOME-SUCCESS-[0-9a-f]+`)
+
+func (h *becomeHost) RunCommand(command string) (stdout, stderr *bytes.Buffer, err error) {
+	stdout, stderr = new(bytes.Buffer), new(bytes.Buffer)
+	err = h.StreamCommand(&remote.Command{Command: command, Stdout: stdout, Stderr: stderr})
+	return
+}
+
+func (h *becomeHost) StreamCommand(c *remote.Command) error {
+	h.lock.Lock()
+	h.commands = append(h.commands, c.Command)
+	h.lock.Unlock()
+	if strings.HasPrefix(c.Command, "mktemp") {
+		fmt.Fprintln(c.Stdout, "/tmp/octopus-become.stage")
+		return nil
+	}
+	if !strings.HasPrefix(c.Command, "sudo") {
+		return nil
+	}
+
+	var stdin *bufio.Reader
+	if c.Stdin != nil {
+		stdin = bufio.NewReader(c.Stdin)
+	}
+	if h.needsPassword {
+		if strings.Contains(c.Command, " -n ") {
+			fmt.Fprintln(c.Stderr, "sudo: a password is required")
+			return &remote.ExitError{Status: remote.ExitStatus{Code: 1}}
+		}
+		for tries := 1; ; tries++ {
+			fmt.Fprint(c.Stderr, sudoPrompt)
+			p, _ := stdin.ReadString('\n')
+			if p == "secret\n" {
+				break
+			}
+			if p == "" || p == "\n" || tries == 3 {
+				fmt.Fprintln(c.Stderr, "sudo: 1 incorrect password attempt")
+				return &remote.ExitError{Status: remote.ExitStatus{Code: 1}}
+			}
+			fmt.Fprintln(c.Stderr, "Sorry, try again.")
+		}
+	}
+	if m := markerRegexp.FindString(c.Command); m != "" {
+		fmt.Fprintln(c.Stdout, m)
+	}
+	fmt.Fprintln(c.Stdout, "ran")
+	if stdin != nil {
+		in, _ := ioutil.ReadAll(stdin)
+		c.Stdout.Write(in)
+	}
+	return nil
+}
+
+func (h *becomeHost) CopyFileToRemote(localSource *os.File, remoteFilePath string, info os.FileInfo) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.copies = append(h.copies, remoteFilePath)
+	return nil
+}
+
+func Test_becomeActor_StreamCommand(t *testing.T) {
+	tests := []struct {
+		name          string
+		needsPassword bool
+		password      []byte
+		stdin         string
+		wantStdout    string
+		wantStderr    string
+		wantErr       bool
+	}{
+		{"no password needed", false, nil, "", "ran\n", "", false},
+		{"no password needed with stdin", false, nil, "input\n", "ran\ninput\n", "", false},
+		{"password not given", true, nil, "", "", "sudo: a password is required\n", true},
+		{"password", true, []byte("secret"), "", "ran\n", "", false},
+		{"password with stdin", true, []byte("secret"), "input\n", "ran\ninput\n", "", false},
+		{"password not needed with stdin", false, []byte("secret"), "input\n", "ran\ninput\n", "", false},
+		{"wrong password", true, []byte("wrong"), "input\n", "",
+			"Sorry, try again.\nsudo: 1 incorrect password attempt\n", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := NewBecome(SudoBecome, tt.password, nil)
+			assert.NoError(t, err)
+			h := &becomeHost{needsPassword: tt.needsPassword}
+			a := newBecomeActor(h, b)
+			stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+			c := &remote.Command{Command: "id -u", Stdout: stdout, Stderr: stderr}
+			if tt.stdin != "" {
+				c.Stdin = strings.NewReader(tt.stdin)
+			}
+			err = a.StreamCommand(c)
+			assert.Equal(t, tt.wantErr, err != nil, "error: %+v", err)
+			assert.Equal(t, tt.wantStdout, stdout.String())
+			assert.Equal(t, tt.wantStderr, stderr.String())
+			assert.Len(t, h.commands, 1)
+			assert.Contains(t, h.commands[0], "sudo ")
+		})
+	}
+}
+
+func Test_becomeActor_copy(t *testing.T) {
+	tmpRoot, cleanup := testutil.TempDir("")
+	defer cleanup()
+	f, err := ioutil.TempFile(tmpRoot, "file")
+	assert.NoError(t, err)
+	defer f.Close()
+	info, err := f.Stat()
+	assert.NoError(t, err)
+
+	b, err := NewBecome(SudoBecome, nil, nil)
+	assert.NoError(t, err)
+	h := &becomeHost{}
+	a := newBecomeActor(h, b)
+
+	// nothing is staged or cleaned up if no files are copied
+	a.cleanUp()
+	assert.Len(t, h.commands, 0)
+
+	assert.NoError(t, a.CreateRemoteDir("/etc/app", 0755))
+	assert.NoError(t, a.CopyFileToRemote(f, "/etc/app/a.conf", info))
+	assert.NoError(t, a.CopyFileToRemote(f, "/etc/app/b.conf", info))
+	a.cleanUp()
+
+	assert.Equal(t, []string{"/tmp/octopus-become.stage/1", "/tmp/octopus-become.stage/2"}, h.copies)
+	assert.Equal(t, []string{
+		`sudo -n -- sh -c '[ -d '\''/etc/app'\'' ] || { mkdir -p '\''/etc/app'\'' && chmod 755 '\''/etc/app'\''; }'`,
+		`mktemp -d "${TMPDIR:-/tmp}/octopus-become.XXXXXXXXXX"`,
+		`sudo -n -- sh -c 'mv -f '\''/tmp/octopus-become.stage/1'\'' '\''/etc/app/a.conf'\'' && chown "$(id -u):$(id -g)" '\''/etc/app/a.conf'\'''`,
+		`sudo -n -- sh -c 'mv -f '\''/tmp/octopus-become.stage/2'\'' '\''/etc/app/b.conf'\'' && chown "$(id -u):$(id -g)" '\''/etc/app/b.conf'\'''`,
+		`rm -rf '/tmp/octopus-become.stage'`,
+	}, h.commands)
+}
+
+func TestOctopus_Do_become(t *testing.T) {
+	getAddrsFromGroupsFile = func(hostGroups []string, groupsFile string) ([][]string, error) {
+		return [][]string{{"1.1.1.1", "2.2.2.2"}}, nil
+	}
+	var action remote.Action = func(a remote.Actor, h *remote.HostInfo) (o, e *bytes.Buffer, err error) {
+		return a.RunCommand("id -u")
+	}
+
+	b, err := NewBecome(SudoBecome, nil, nil)
+	assert.NoError(t, err)
+	c := &remotetest.MockRemoteConnector{ReturnActor: &remotetest.MockRemoteActor{}}
+	o := New(c, []string{"all"}, "_test-groups-file", NewOptions(0, Batch{}, 0, -1,
+		NewTextReporter(ioutil.Discard, ioutil.Discard), "", false, nil, strings.NewReader("input"), b))
+	numHostErrors, err := o.Do(context.Background(), action)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, numHostErrors)
+	// the hostname command doesn't become root, and stdin is still sent to commands which do
+	assert.Len(t, c.ActorsReturned, 2)
+	for _, a := range c.ActorsReturned {
+		assert.ElementsMatch(t, []string{"hostname", `sudo -n -- sh -c 'id -u'`}, a.Commands)
+		assert.Equal(t, []string{"input"}, a.Stdins)
+	}
+}
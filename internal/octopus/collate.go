@@ -0,0 +1,177 @@
+package octopus
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A collatedResult is a result shared by all of the hosts in the group.
+type collatedResult struct {
+	hostnames []string
+	result    Result
+}
+
+// group results whose stdout, stderr, error, and skip reason are byte-identical. Groups are ordered
+// by their first hostname, and hostnames within each group are sorted.
+func collate(results []Result) []collatedResult {
+	groups := []*collatedResult{}
+	byOutput := map[string]*collatedResult{}
+	for _, r := range results {
+		key := collateKey(r)
+		g, ok := byOutput[key]
+		if !ok {
+			g = &collatedResult{hostnames: []string{}, result: r}
+			byOutput[key] = g
+			groups = append(groups, g)
+		}
+		g.hostnames = append(g.hostnames, r.name())
+	}
+
+	collated := make([]collatedResult, 0, len(groups))
+	for _, g := range groups {
+		sort.Strings(g.hostnames)
+		collated = append(collated, *g)
+	}
+	sort.SliceStable(collated, func(i, j int) bool {
+		return collated[i].hostnames[0] < collated[j].hostnames[0]
+	})
+	return collated
+}
+
+func collateKey(r Result) string {
+	errText := ""
+	if r.Err != nil {
+		errText = fmt.Sprintf("%+v", r.Err)
+	}
+	// lengths prevent different outputs from running together into the same key
+	parts := []string{r.Stdout.String(), r.Stderr.String(), errText, r.SkipReason}
+	if r.Stdout == nil {
+		parts[0] = ""
+	}
+	if r.Stderr == nil {
+		parts[1] = ""
+	}
+	key := strconv.FormatBool(r.Skipped) + ":" + strconv.FormatBool(r.Interrupted)
+	for _, p := range parts {
+		key += fmt.Sprintf(":%d:%s", len(p), p)
+	}
+	return key
+}
+
+// A collateReporter prints each group of identical results once after all hosts have finished,
+// with the group's hosts in compact hostlist notation as its header.
+type collateReporter struct {
+	text    *TextReporter
+	results []Result
+}
+
+func (c *collateReporter) Begin(hosts []string) error { return nil }
+
+func (c *collateReporter) HostResult(r *Result) error {
+	c.results = append(c.results, *r)
+	return nil
+}
+
+func (c *collateReporter) End() error {
+	for _, g := range collate(c.results) {
+		if err := c.text.print(&g.result, compressHostList(g.hostnames)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// a hostname split around its last run of digits, e.g., "node" "012" ".local"
+type hostnameParts struct {
+	prefix string
+	digits string
+	suffix string
+}
+
+func splitHostname(hostname string) (hostnameParts, bool) {
+	end := strings.LastIndexAny(hostname, "0123456789")
+	if end < 0 {
+		return hostnameParts{}, false
+	}
+	start := end
+	for start > 0 && hostname[start-1] >= '0' && hostname[start-1] <= '9' {
+		start--
+	}
+	return hostnameParts{hostname[:start], hostname[start : end+1], hostname[end+1:]}, true
+}
+
+// compressHostList compresses a list of hostnames into pdsh-style hostlist range notation, e.g.,
+// node01, node02, ..., node40, node42 become "node[01-40,42]". Zero-padding is preserved.
+func compressHostList(hostnames []string) string {
+	type numbered struct {
+		n      uint64
+		digits string
+	}
+	others := []string{}
+	numbersByAffix := map[[2]string][]numbered{}
+	affixes := [][2]string{}
+	seen := map[string]bool{}
+	for _, h := range hostnames {
+		if seen[h] {
+			continue
+		}
+		seen[h] = true
+		p, ok := splitHostname(h)
+		var n uint64
+		var err error
+		if ok {
+			n, err = strconv.ParseUint(p.digits, 10, 64)
+		}
+		if !ok || err != nil {
+			others = append(others, h)
+			continue
+		}
+		a := [2]string{p.prefix, p.suffix}
+		if _, ok := numbersByAffix[a]; !ok {
+			affixes = append(affixes, a)
+		}
+		numbersByAffix[a] = append(numbersByAffix[a], numbered{n, p.digits})
+	}
+
+	list := others
+	for _, a := range affixes {
+		nums := numbersByAffix[a]
+		if len(nums) == 1 {
+			list = append(list, a[0]+nums[0].digits+a[1])
+			continue
+		}
+		sort.Slice(nums, func(i, j int) bool {
+			if nums[i].n != nums[j].n {
+				return nums[i].n < nums[j].n
+			}
+			return nums[i].digits < nums[j].digits
+		})
+
+		// consecutive numbers are in the same range if they are zero-padded to the same width
+		ranges := []string{}
+		format := func(n uint64, width int) string { return fmt.Sprintf("%0*d", width, n) }
+		for i := 0; i < len(nums); {
+			first := nums[i]
+			width := 0
+			if len(first.digits) > 1 && first.digits[0] == '0' {
+				width = len(first.digits)
+			}
+			last := i
+			for last+1 < len(nums) && nums[last+1].n == nums[last].n+1 &&
+				format(nums[last+1].n, width) == nums[last+1].digits {
+				last++
+			}
+			if last == i {
+				ranges = append(ranges, first.digits)
+			} else {
+				ranges = append(ranges, first.digits+"-"+nums[last].digits)
+			}
+			i = last + 1
+		}
+		list = append(list, a[0]+"["+strings.Join(ranges, ",")+"]"+a[1])
+	}
+	sort.Strings(list)
+	return strings.Join(list, ",")
+}
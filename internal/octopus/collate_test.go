@@ -0,0 +1,79 @@
+package octopus
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_compressHostList(t *testing.T) {
+	tests := []struct {
+		name      string
+		hostnames []string
+		want      string
+	}{
+		{"one host", []string{"node1"}, "node1"},
+		{"no digits", []string{"admin", "master"}, "admin,master"},
+		{"range", []string{"node3", "node1", "node2"}, "node[1-3]"},
+		{"ranges and singles", []string{"node01", "node02", "node03", "node05", "node07", "node08"},
+			"node[01-03,05,07-08]"},
+		{"padded range crosses width", []string{"node08", "node09", "node10", "node11"}, "node[08-11]"},
+		{"unpadded range crosses width", []string{"node9", "node10", "node11"}, "node[9-11]"},
+		{"different padding is not one range", []string{"node01", "node2"}, "node[01,2]"},
+		{"suffix", []string{"node1.local", "node2.local", "node3.cluster"},
+			"node3.cluster,node[1-2].local"},
+		{"different prefixes", []string{"master1", "node1", "node2", "master2"}, "master[1-2],node[1-2]"},
+		{"duplicates", []string{"node1", "node1", "node2"}, "node[1-2]"},
+		{"IP addresses", []string{"10.0.0.5", "10.0.0.6", "10.0.1.5"}, "10.0.0.[5-6],10.0.1.5"},
+		{"mixed", []string{"admin", "node2", "node1"}, "admin,node[1-2]"},
+		{"huge number", []string{"node99999999999999999999", "node1"},
+			"node1,node99999999999999999999"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, compressHostList(tt.hostnames))
+		})
+	}
+
+	many := []string{}
+	for i := 1; i <= 42; i++ {
+		if i != 41 {
+			many = append(many, fmt.Sprintf("node%02d", i))
+		}
+	}
+	assert.Equal(t, "node[01-40,42]", compressHostList(many))
+}
+
+func Test_collate(t *testing.T) {
+	bs := bytes.NewBufferString
+	results := []Result{
+		{Hostname: "node3", Stdout: bs("4.19\n"), Stderr: bs("")},
+		{Hostname: "node1", Stdout: bs("4.19\n"), Stderr: bs("")},
+		{Hostname: "node2", Stdout: bs("5.4\n"), Stderr: bs("")},
+		{Hostname: "node4", Stdout: bs("4.19\n"), Stderr: bs("warning\n")},
+		{Hostname: "node5", Stdout: bs("4.19\n"), Stderr: bs(""), Err: fmt.Errorf("exit 1")},
+		{Hostname: "node6", Stdout: bs("4.19\n"), Stderr: bs(""), Err: fmt.Errorf("exit 1")},
+		{Hostname: "node7", Skipped: true, SkipReason: "stopped"},
+		{Hostname: "node8", Stdout: nil, Stderr: nil, Err: fmt.Errorf("could not connect")},
+		// output which would be the same if stdout and stderr were simply concatenated
+		{Hostname: "node9", Stdout: bs("4.1"), Stderr: bs("9\n")},
+	}
+	got := collate(results)
+	hostnames := [][]string{}
+	for _, c := range got {
+		hostnames = append(hostnames, c.hostnames)
+	}
+	assert.Equal(t, [][]string{
+		{"node1", "node3"},
+		{"node2"},
+		{"node4"},
+		{"node5", "node6"},
+		{"node7"},
+		{"node8"},
+		{"node9"},
+	}, hostnames)
+	assert.Equal(t, "4.19\n", got[0].result.Stdout.String())
+	assert.Equal(t, "exit 1", got[3].result.Err.Error())
+}
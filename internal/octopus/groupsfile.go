@@ -10,33 +10,45 @@ import (
 	"github.com/BlaineEXE/octopus/internal/logger"
 )
 
+// Returns the host entries of each of the host groups in order.
 // Allow this to be overridden for tests.
-var getAddrsFromGroupsFile = func(hostGroups []string, groupsFile string) ([]string, error) {
+var getAddrsFromGroupsFile = func(hostGroups []string, groupsFile string) ([][]string, error) {
 	logger.Info.Println("groups file: ", groupsFile)
 
 	fileGroups, err := getAllGroupsInFile(groupsFile)
 	if err != nil {
-		return []string{}, fmt.Errorf("error parsing groups file %s: %+v", groupsFile, err)
+		return [][]string{}, fmt.Errorf("error parsing groups file %s: %+v", groupsFile, err)
 	}
 
-	// Make a '${<group>}' argument for each group
+	// Make an 'echo ${<group>}' command for each group
 	gVars := []string{}
 	for _, g := range hostGroups {
 		if _, ok := fileGroups[g]; !ok {
-			return []string{}, fmt.Errorf("host group %s not found in groups file %s", g, groupsFile)
+			return [][]string{}, fmt.Errorf("host group %s not found in groups file %s", g, groupsFile)
 		}
-		gVars = append(gVars, fmt.Sprintf("${%s}", g))
+		gVars = append(gVars, fmt.Sprintf("echo ${%s}", g))
+	}
+	if len(gVars) == 0 {
+		return [][]string{}, nil
 	}
 
-	// Source the hosts file, and echo all the groups without newlines to get all hosts
+	// Source the hosts file, and echo each group without newlines on its own line to get all hosts
 	cmd := exec.Command("bash", "-ec",
-		fmt.Sprintf("source %s ; echo %s", groupsFile, strings.Join(gVars, " ")))
+		fmt.Sprintf("source %s ; %s", groupsFile, strings.Join(gVars, " ; ")))
 	o, err := cmd.CombinedOutput()
 	if err != nil {
-		return []string{}, fmt.Errorf("could not get groups %+v from %s: %+v\n%s", hostGroups, groupsFile, err, string(o))
+		return [][]string{}, fmt.Errorf("could not get groups %+v from %s: %+v\n%s", hostGroups, groupsFile, err, string(o))
 	}
 
-	addrs := strings.Fields(string(o))
+	lines := strings.Split(strings.TrimSuffix(string(o), "\n"), "\n")
+	if len(lines) != len(hostGroups) {
+		return [][]string{}, fmt.Errorf("could not get groups %+v from %s: got %d lines of hosts for %d groups\n%s",
+			hostGroups, groupsFile, len(lines), len(hostGroups), string(o))
+	}
+	addrs := make([][]string, 0, len(lines))
+	for _, l := range lines {
+		addrs = append(addrs, strings.Fields(l))
+	}
 	return addrs, nil
 }
 
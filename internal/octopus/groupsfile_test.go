@@ -8,7 +8,7 @@ import (
 	"github.com/BlaineEXE/octopus/internal/util/testutil"
 )
 
-var runtimeGetAddrsFromGroupsFile func(hostGroups []string, groupsFile string) ([]string, error)
+var runtimeGetAddrsFromGroupsFile func(hostGroups []string, groupsFile string) ([][]string, error)
 
 func init() {
 	// On init, store the default version of getAddrsFromGroupsFile which will execute at runtime
@@ -53,6 +53,9 @@ export md9to12="9.9.9.9 10.10.10.10
 11.11.11.11 12.12.12.12"
 export ms13to16='13.13.13.13 14.14.14.14
 15.15.15.15 16.16.16.16'
+
+# empty
+export empty=""
 `
 
 const noGroups = `
@@ -85,29 +88,31 @@ func Test_getAddrsFromGroupsFile(t *testing.T) {
 		name       string
 		groupsFile string
 		hostGroups []string
-		want       []string
+		want       [][]string
 		wantErr    bool
 	}{
-		{"unreadable file", writeonlyGroupsFile, []string{"a"}, []string{}, true},
-		{"no groups in file", noGroupsFile, []string{"a"}, []string{}, true},
-		{"unparsable file", unparsableGroupsFile, []string{"a", "t"}, []string{}, true},
-		{"group not in file", goodGroupsFile, []string{"a", "notIn"}, []string{}, true},
-		{"simple double", goodGroupsFile, []string{"a", "_3"}, []string{"1.1.1.1", "3.3.3.3"}, false},
-		{"simple single", goodGroupsFile, []string{"b", "_4"}, []string{"2.2.2.2", "4.4.4.4"}, false},
+		{"unreadable file", writeonlyGroupsFile, []string{"a"}, [][]string{}, true},
+		{"no groups in file", noGroupsFile, []string{"a"}, [][]string{}, true},
+		{"unparsable file", unparsableGroupsFile, []string{"a", "t"}, [][]string{}, true},
+		{"group not in file", goodGroupsFile, []string{"a", "notIn"}, [][]string{}, true},
+		{"simple double", goodGroupsFile, []string{"a", "_3"}, [][]string{{"1.1.1.1"}, {"3.3.3.3"}}, false},
+		{"simple single", goodGroupsFile, []string{"b", "_4"}, [][]string{{"2.2.2.2"}, {"4.4.4.4"}}, false},
 		{"double multi", goodGroupsFile, []string{"d34", "d5_6", "d_78", "d_9_10", "d_11_12_"},
-			[]string{"3.3.3.3", "4.4.4.4", "5.5.5.5", "6.6.6.6", "7.7.7.7", "8.8.8.8", "9.9.9.9",
-				"10.10.10.10", "11.11.11.11", "12.12.12.12"}, false},
+			[][]string{{"3.3.3.3", "4.4.4.4"}, {"5.5.5.5", "6.6.6.6"}, {"7.7.7.7", "8.8.8.8"},
+				{"9.9.9.9", "10.10.10.10"}, {"11.11.11.11", "12.12.12.12"}}, false},
 		{"single multi", goodGroupsFile, []string{"s56", "s_7_8_"},
-			[]string{"5.5.5.5", "6.6.6.6", "7.7.7.7", "8.8.8.8"}, false},
+			[][]string{{"5.5.5.5", "6.6.6.6"}, {"7.7.7.7", "8.8.8.8"}}, false},
 		{"leading+trailing space", goodGroupsFile, []string{"ltd78", "lts910"},
-			[]string{"7.7.7.7", "8.8.8.8", "9.9.9.9", "10.10.10.10"}, false},
+			[][]string{{"7.7.7.7", "8.8.8.8"}, {"9.9.9.9", "10.10.10.10"}}, false},
 		{"mixed", goodGroupsFile, []string{"md9to12", "ms13to16"},
-			[]string{"9.9.9.9", "10.10.10.10", "11.11.11.11", "12.12.12.12",
-				"13.13.13.13", "14.14.14.14", "15.15.15.15", "16.16.16.16"}, false},
+			[][]string{{"9.9.9.9", "10.10.10.10", "11.11.11.11", "12.12.12.12"},
+				{"13.13.13.13", "14.14.14.14", "15.15.15.15", "16.16.16.16"}}, false},
 		{"arbitrary, out of order selection", goodGroupsFile, []string{"md9to12", "ltd78", "_4"},
-			[]string{"9.9.9.9", "10.10.10.10", "11.11.11.11", "12.12.12.12",
-				"7.7.7.7", "8.8.8.8", "4.4.4.4"}, false},
-		{"invalid var name", invalidVarName, []string{}, []string{}, true},
+			[][]string{{"9.9.9.9", "10.10.10.10", "11.11.11.11", "12.12.12.12"},
+				{"7.7.7.7", "8.8.8.8"}, {"4.4.4.4"}}, false},
+		{"empty group", goodGroupsFile, []string{"a", "empty", "b"},
+			[][]string{{"1.1.1.1"}, {}, {"2.2.2.2"}}, false},
+		{"invalid var name", invalidVarName, []string{}, [][]string{}, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -3,32 +3,86 @@
 package octopus
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/BlaineEXE/octopus/internal/logger"
 	"github.com/BlaineEXE/octopus/internal/remote"
 )
 
+// ErrInterrupted is returned by Octopus.Do when the octopus is interrupted before all hosts finish.
+var ErrInterrupted = errors.New("interrupted")
+
+// the reason hosts are skipped when the octopus is interrupted
+const interruptedReason = "octopus was interrupted"
+
 // Octopus is a metaphorical octopus which can run commands on remote hosts in parallel with its
 // many arms.
 type Octopus struct {
 	remoteConnector remote.Connector
 	hostGroups      []string
 	groupsFile      string
+	opts            *Options
+}
+
+// Options is a collection of additional options for how an octopus operates on hosts.
+type Options struct {
+	fanout      uint // max number of hosts operated on at once; 0 means no limit
+	batch       Batch
+	batchPause  time.Duration // time to wait between batches
+	maxFailures int           // stop after a batch with more failed hosts than this; -1 means never
+	reporter    Reporter      // outputs results
+	outputDir   string        // dir to which each host's output is also written; "" means none
+	summary     bool          // print a summary of all hosts' results at the end
+	reports     []Report      // report files written with all hosts' results at the end
+	stdin       io.Reader     // sent to every command run on hosts; nil means none
+	become      *Become       // how commands become root; nil means they run as the login user
+}
+
+// NewOptions creates a new option struct for defining how an octopus operates on hosts.
+// Create new options in a function instead of relying on a struct so developers are less likely to
+// leave a newly created option unset.
+func NewOptions(
+	fanout uint, batch Batch, batchPause time.Duration, maxFailures int, reporter Reporter,
+	outputDir string, summary bool, reports []Report, stdin io.Reader, become *Become,
+) *Options {
+	return &Options{
+		fanout:      fanout,
+		batch:       batch,
+		batchPause:  batchPause,
+		maxFailures: maxFailures,
+		reporter:    reporter,
+		outputDir:   outputDir,
+		summary:     summary,
+		reports:     reports,
+		stdin:       stdin,
+		become:      become,
+	}
 }
 
 // New finds an octopus and trains it about how its environment is configured and what host groups
 // it should operate on.
-func New(c remote.Connector, hostGroups []string, groupsFile string) *Octopus {
+func New(c remote.Connector, hostGroups []string, groupsFile string, opts *Options) *Octopus {
 	return &Octopus{
 		remoteConnector: c,
 		hostGroups:      hostGroups,
 		groupsFile:      groupsFile,
+		opts:            opts,
 	}
 }
 
+// the reporter if command output is streamed as it is received, or nil otherwise
+func (o *Octopus) streamer() *streamReporter {
+	s, _ := o.opts.reporter.(*streamReporter)
+	return s
+}
+
 // ValidHostGroups returns a list of host groups which are available for Octopus to run against.
 func (o *Octopus) ValidHostGroups() ([]string, error) {
 	logger.Info.Println("groups file: ", o.groupsFile)
@@ -47,58 +101,339 @@ func (o *Octopus) ValidHostGroups() ([]string, error) {
 
 // Do sends out tentacles to all hosts in the host group(s) in individual goroutines and collects
 // the results of all the tentacles at the end. Returns the number of hosts that report errors if
-// the tentacles are able to be sent out.
-func (o *Octopus) Do(action remote.Action) (numHostErrors int, err error) {
+// the tentacles are able to be sent out. If the octopus has a fanout limit, hosts beyond the limit
+// wait for tentacles to return from other hosts before tentacles are sent out to them.
+// Hosts are operated on in batches, one batch after the other. If a batch has more failed hosts
+// than allowed, the remaining hosts are not operated on and are reported as skipped.
+// Results are given to the reporter as they arrive. Results are also written to the output dir if
+// there is one. A summary of all results is printed to stderr at the end if it is wanted, and
+// report files are written at the end. Failing to write a report file returns an error along with
+// the number of host errors.
+// If there is stdin, all of it is sent to every command run on every host. If commands are to
+// become root, all actions on hosts are done as root.
+// Once the context is canceled, actions in progress on hosts are interrupted and reported as
+// such, hosts which have not been operated on yet are reported as skipped, and ErrInterrupted is
+// returned along with the number of host errors after results have been reported.
+func (o *Octopus) Do(ctx context.Context, action remote.Action) (numHostErrors int, err error) {
+	return o.do(ctx, action, true)
+}
+
+// DoWithoutConnecting is the same as Do, but hosts are never connected to. Actions are given a nil
+// actor and host info without a Hostname function, so they may only use what is known about hosts
+// from the host groups (e.g., to output what would be done in a dry run). Stdin is not read, and
+// results are identified by their hosts.
+func (o *Octopus) DoWithoutConnecting(
+	ctx context.Context, action remote.Action,
+) (numHostErrors int, err error) {
+	return o.do(ctx, action, false)
+}
+
+func (o *Octopus) do(
+	ctx context.Context, action remote.Action, connect bool,
+) (numHostErrors int, err error) {
 	logger.Info.Println("host groups:", o.hostGroups)
-	hostAddrs, err := getAddrsFromGroupsFile(o.hostGroups, o.groupsFile)
+	groupAddrs, err := getAddrsFromGroupsFile(o.hostGroups, o.groupsFile)
+	if err != nil {
+		return -1, err
+	}
+	hosts, err := parseHosts(o.hostGroups, groupAddrs)
 	if err != nil {
 		return -1, err
 	}
 
-	rch := make(chan Result, len(hostAddrs))
-	for i := 0; i < len(hostAddrs); i++ {
-		go func(host string) {
-			result := Result{
-				// fallback hostname includes the raw host (e.g., IP) for some ability to identify the host
-				Hostname: fmt.Sprintf("%s: could not get hostname", host),
-				// fallback error - should never be returned, but *just* in case, make sure it isn't nil
-				Err: fmt.Errorf("failed to send tentacle: unable to get more detail"),
+	var stdin *stdinBuffer
+	if connect && o.opts.stdin != nil {
+		if stdin, err = newStdinBuffer(o.opts.stdin); err != nil {
+			return -1, err
+		}
+		defer stdin.Close()
+	}
+
+	var dirWriter *outputDirWriter
+	if o.opts.outputDir != "" {
+		if dirWriter, err = newOutputDirWriter(o.opts.outputDir); err != nil {
+			return -1, err
+		}
+	}
+
+	hostStrings := make([]string, 0, len(hosts))
+	for _, h := range hosts {
+		hostStrings = append(hostStrings, h.Host.String())
+	}
+	if err := o.opts.reporter.Begin(hostStrings); err != nil {
+		logger.Warning.Printf("failed to begin reporting results: %+v", err)
+	}
+
+	start := time.Now()
+	all := []Result{}
+	report := func(r Result) {
+		if o.opts.summary || len(o.opts.reports) > 0 {
+			all = append(all, r)
+		}
+		if dirWriter != nil {
+			if err := dirWriter.write(&r); err != nil {
+				logger.Warning.Printf("failed to write output files for host %s: %+v", r.Host, err)
 			}
-			defer func() { rch <- result }()
-			actor, err := o.remoteConnector.Connect(host)
-			if err != nil {
-				result.Err = err
-				return
+		}
+		if err := o.opts.reporter.HostResult(&r); err != nil {
+			logger.Warning.Printf("failed to report result for host %s: %+v", r.Host, err)
+		}
+	}
+
+	numHostErrors = 0
+	batches := o.opts.batch.split(hosts)
+	for i, batch := range batches {
+		if i > 0 && o.opts.batchPause > 0 {
+			logger.Info.Println("pausing before next batch for", o.opts.batchPause)
+			select {
+			case <-time.After(o.opts.batchPause):
+			case <-ctx.Done():
 			}
-			defer actor.Close()
-
-			// get the host's hostname (in parallel) for easier human identification
-			logger.Info.Println("running hostname command on host:", host)
-			hch := make(chan string)
-			go func() {
-				defer close(hch)
-				o, _, err := actor.RunCommand("hostname")
-				if err != nil {
-					hch <- result.Hostname // use fallback hostname on error
-					return
-				}
-				hch <- strings.TrimRight(o.String(), "\n")
-			}()
+		}
+		if ctx.Err() != nil {
+			o.skip(batches[i:], interruptedReason, report)
+			break
+		}
+		hosts := make([]string, 0, len(batch))
+		for _, h := range batch {
+			hosts = append(hosts, h.Host.String())
+		}
+		logger.Info.Printf("batch %d of %d: %v", i+1, len(batches), hosts)
 
-			// Do whatever action the user wants
-			result.Stdout, result.Stderr, result.Err = action(actor)
+		batchErrors := o.doBatch(ctx, batch, action, connect, stdin, report)
+		numHostErrors += batchErrors
 
-			result.Hostname = <-hch
-		}(hostAddrs[i])
+		// hosts after an interruption are skipped because of it rather than because of failures
+		if ctx.Err() == nil && o.opts.maxFailures >= 0 && batchErrors > o.opts.maxFailures && i < len(batches)-1 {
+			reason := fmt.Sprintf("%d hosts failed in batch %d of %d, which is more than the %d allowed",
+				batchErrors, i+1, len(batches), o.opts.maxFailures)
+			logger.Info.Println("stopping:", reason)
+			o.skip(batches[i+1:], reason, report)
+			break
+		}
+	}
+
+	if err := o.opts.reporter.End(); err != nil {
+		logger.Warning.Printf("failed to report results: %+v", err)
+	}
+	total := time.Since(start)
+	if o.opts.summary {
+		newSummary(all, total).print(summaryOutput)
+	}
+	suite := strings.Join(o.hostGroups, ",")
+	for _, rep := range o.opts.reports {
+		logger.Info.Println("writing report", rep)
+		if err := rep.write(suite, all, total); err != nil {
+			return numHostErrors, err
+		}
+	}
+	if ctx.Err() != nil {
+		return numHostErrors, ErrInterrupted
+	}
+	return numHostErrors, nil
+}
+
+// report all hosts in the batches as skipped
+func (o *Octopus) skip(batches [][]*remote.HostInfo, reason string, report func(Result)) {
+	for _, batch := range batches {
+		for _, host := range batch {
+			report(o.skipped(host, reason))
+		}
 	}
+}
+
+func (o *Octopus) skipped(host *remote.HostInfo, reason string) Result {
+	return Result{Host: host.Host.String(), Skipped: true, SkipReason: reason,
+		Streamed: o.streamer() != nil}
+}
+
+// send out tentacles to all hosts in the batch, report each result as it arrives, and return the
+// number of hosts that report errors
+func (o *Octopus) doBatch(
+	ctx context.Context,
+	hosts []*remote.HostInfo, action remote.Action, connect bool, stdin *stdinBuffer,
+	report func(Result),
+) (numHostErrors int) {
+	rch := make(chan Result, len(hosts))
+	// send out tentacles in the background so results are reported while hosts wait for the fanout
+	go func() {
+		var sem chan struct{}
+		if o.opts.fanout > 0 {
+			logger.Info.Println("fanout:", o.opts.fanout)
+			sem = make(chan struct{}, o.opts.fanout)
+		}
+		for i := 0; i < len(hosts); i++ {
+			if sem != nil {
+				select {
+				case sem <- struct{}{}:
+				case <-ctx.Done():
+				}
+			}
+			// hosts still waiting for the fanout are not operated on once interrupted
+			if ctx.Err() != nil {
+				rch <- o.skipped(hosts[i], interruptedReason)
+				continue
+			}
+			go func(host *remote.HostInfo) {
+				if connect {
+					rch <- o.sendTentacle(ctx, host, action, stdin)
+				} else {
+					rch <- o.doWithoutConnecting(ctx, host, action)
+				}
+				if sem != nil {
+					<-sem
+				}
+			}(hosts[i])
+		}
+	}()
 
 	numHostErrors = 0
-	for range hostAddrs {
+	for range hosts {
 		r := <-rch
-		r.Print()
+		report(r)
 		if r.Err != nil {
 			numHostErrors++
 		}
 	}
-	return numHostErrors, nil
+	return numHostErrors
+}
+
+// send a tentacle to perform the action on a single host, and return the result
+func (o *Octopus) sendTentacle(
+	ctx context.Context, info *remote.HostInfo, action remote.Action, stdin *stdinBuffer,
+) (result Result) {
+	host := info.Host
+	result = Result{
+		Host:  host.String(),
+		Start: time.Now(),
+		// fallback error - should never be returned, but *just* in case, make sure it isn't nil
+		Err:      fmt.Errorf("failed to send tentacle: unable to get more detail"),
+		Streamed: o.streamer() != nil,
+	}
+	defer func() {
+		result.End = time.Now()
+		// actions report errors in their own ways, so any error once interrupted is an interruption
+		result.Interrupted = result.Err != nil && ctx.Err() != nil
+	}()
+	actor, err := o.remoteConnector.Connect(ctx, host)
+	if err != nil {
+		result.Err = err
+		return
+	}
+	defer actor.Close()
+	result.Connected = true
+
+	// get the host's hostname (in parallel) for easier human identification
+	hch := make(chan string)
+	go func() {
+		defer close(hch)
+		hch <- getHostname(actor, host)
+	}()
+	var once sync.Once
+	hostname := func() string {
+		once.Do(func() { result.Hostname = <-hch })
+		return result.Hostname
+	}
+	// give the action its own copy of the host info so the hostname is of this tentacle's host
+	i := *info
+	i.Hostname = hostname
+
+	// the hostname command is run on the plain actor so it doesn't use stdin or become root
+	var a remote.Actor = actor
+	if o.opts.become != nil {
+		b := newBecomeActor(a, o.opts.become)
+		defer b.cleanUp()
+		a = b
+	}
+	if stdin != nil {
+		a = newStdinActor(a, stdin)
+	}
+
+	if s := o.streamer(); s != nil {
+		// the hostname is needed to prefix output before the action can begin
+		hostname()
+		result.Stdout, result.Stderr, result.Err = action(newStreamingActor(a, result.name(), s), &i)
+		result.ExitStatus = exitStatus(result.Err)
+		return
+	}
+
+	// Do whatever action the user wants
+	result.Stdout, result.Stderr, result.Err = action(a, &i)
+	result.ExitStatus = exitStatus(result.Err)
+
+	hostname()
+	return
+}
+
+// do the action for the host without connecting to it
+func (o *Octopus) doWithoutConnecting(
+	ctx context.Context, info *remote.HostInfo, action remote.Action,
+) Result {
+	i := *info
+	i.Hostname = nil
+	result := Result{
+		Host:     info.Host.String(),
+		Start:    time.Now(),
+		Local:    true,
+		Streamed: o.streamer() != nil,
+	}
+	result.Stdout, result.Stderr, result.Err = action(nil, &i)
+	result.End = time.Now()
+	result.Interrupted = result.Err != nil && ctx.Err() != nil
+	if s := o.streamer(); s != nil {
+		s.writeOutput(&result)
+	}
+	return result
+}
+
+// get the host's hostname for easier human identification, or return "" on error
+func getHostname(actor remote.Actor, host remote.Host) string {
+	logger.Info.Println("running hostname command on host:", host)
+	o, _, err := actor.RunCommand("hostname")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimRight(o.String(), "\n")
+}
+
+// parse the host entries of each host group from the groups file into host targets. Each entry is
+// of the form [user@]address[:port][,key=value]...
+func parseHosts(hostGroups []string, groupAddrs [][]string) ([]*remote.HostInfo, error) {
+	hosts := []*remote.HostInfo{}
+	groupsOf := map[string][]string{} // the groups which have each host
+	for i, addrs := range groupAddrs {
+		for j, a := range addrs {
+			h, attrs, err := parseHostEntry(a)
+			if err != nil {
+				return []*remote.HostInfo{}, fmt.Errorf("failed to parse host group entry. %+v", err)
+			}
+			hosts = append(hosts, &remote.HostInfo{Host: h, Group: hostGroups[i], Index: j, Attrs: attrs})
+			g := groupsOf[h.String()]
+			if len(g) == 0 || g[len(g)-1] != hostGroups[i] {
+				groupsOf[h.String()] = append(g, hostGroups[i])
+			}
+		}
+	}
+	for _, h := range hosts {
+		h.Groups = groupsOf[h.Host.String()]
+	}
+	return hosts, nil
+}
+
+// parse a host entry of the form [user@]address[:port][,key=value]...
+func parseHostEntry(entry string) (remote.Host, map[string]string, error) {
+	parts := strings.Split(entry, ",")
+	h, err := remote.ParseHost(parts[0])
+	if err != nil {
+		return remote.Host{}, nil, err
+	}
+	attrs := map[string]string{}
+	for _, p := range parts[1:] {
+		kv := strings.SplitN(p, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return remote.Host{}, nil, fmt.Errorf("invalid attribute %q in host %q. attributes must be of the form key=value", p, entry)
+		}
+		attrs[kv[0]] = kv[1]
+	}
+	return h, attrs, nil
 }
@@ -4,11 +4,15 @@ package octopus
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/BlaineEXE/octopus/internal/logger"
 	"github.com/BlaineEXE/octopus/internal/remote"
@@ -140,20 +144,20 @@ func TestOctopus_Do(t *testing.T) {
 	allConnects := []string{"1.1.1.1", "2.2.2.2", "10.10.10.10"}
 	allHostnames := []string{"1.1.1.1-hostname", "2.2.2.2-hostname", "10.10.10.10-hostname"}
 	failGetAddrsFromGroupsFile := false
-	getAddrsFromGroupsFile = func(hostGroups []string, groupsFile string) ([]string, error) {
+	getAddrsFromGroupsFile = func(hostGroups []string, groupsFile string) ([][]string, error) {
 		assert.Equal(t, "cars", hostGroups[0])
 		assert.Equal(t, "trucks", hostGroups[1])
 		assert.Equal(t, "_test-groups-file", groupsFile)
 		if failGetAddrsFromGroupsFile {
-			return []string{}, fmt.Errorf("test getaddrsfromhostgroups fail")
+			return [][]string{}, fmt.Errorf("test getaddrsfromhostgroups fail")
 		}
-		return allConnects, nil
+		return [][]string{allConnects[:2], allConnects[2:]}, nil
 	}
 
 	failActions := 0 // fail this many actions
 	actionsRun := 0  // num of actions that have been run
 	actorsCalled := []remote.Actor{}
-	var testAction remote.Action = func(a remote.Actor) (stdout, stderr *bytes.Buffer, err error) {
+	var testAction remote.Action = func(a remote.Actor, h *remote.HostInfo) (stdout, stderr *bytes.Buffer, err error) {
 		actionsRun++
 		actorsCalled = append(actorsCalled, a)
 		if actionsRun <= failActions {
@@ -213,6 +217,7 @@ func TestOctopus_Do(t *testing.T) {
 				remoteConnector: tt.remoteConnector,
 				hostGroups:      []string{"cars", "trucks"},
 				groupsFile:      "_test-groups-file",
+				opts:            NewOptions(0, Batch{}, 0, -1, NewTextReporter(ioutil.Discard, ioutil.Discard), "", false, nil, nil, nil),
 			}
 			tt.remoteConnector.ReturnActor = &remotetest.MockRemoteActor{}
 			tt.remoteConnector.ReturnActor.HostnameError = tt.failHostname
@@ -221,7 +226,7 @@ func TestOctopus_Do(t *testing.T) {
 			failActions = tt.failActions
 			failGetAddrsFromGroupsFile = tt.failGetAddrsFromGroupsFile
 
-			gotNumHostErrors, err := o.Do(testAction)
+			gotNumHostErrors, err := o.Do(context.Background(), testAction)
 			if (err != nil) != tt.wants.err {
 				t.Errorf("Octopus.Do() error = %v, want err %v", err, tt.wants.err)
 				return
@@ -243,3 +248,290 @@ func TestOctopus_Do(t *testing.T) {
 		})
 	}
 }
+
+func Test_parseHosts(t *testing.T) {
+	hosts, err := parseHosts([]string{"osds", "all"}, [][]string{
+		{"1.1.1.1,osd=0,rack=r1", "admin@10.0.0.5:2222,osd=1"},
+		{"[fe80::1]:22", "1.1.1.1,osd=0,rack=r1"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []*remote.HostInfo{
+		{Host: remote.Host{Address: "1.1.1.1"}, Group: "osds", Index: 0, Groups: []string{"osds", "all"},
+			Attrs: map[string]string{"osd": "0", "rack": "r1"}},
+		{Host: remote.Host{Address: "10.0.0.5", User: "admin", Port: 2222}, Group: "osds", Index: 1,
+			Groups: []string{"osds"}, Attrs: map[string]string{"osd": "1"}},
+		{Host: remote.Host{Address: "fe80::1", Port: 22}, Group: "all", Index: 0,
+			Groups: []string{"all"}, Attrs: map[string]string{}},
+		{Host: remote.Host{Address: "1.1.1.1"}, Group: "all", Index: 1, Groups: []string{"osds", "all"},
+			Attrs: map[string]string{"osd": "0", "rack": "r1"}},
+	}, hosts)
+
+	_, err = parseHosts([]string{"all"}, [][]string{{"1.1.1.1", "node:ssh"}})
+	assert.Error(t, err)
+}
+
+func Test_parseHostEntry(t *testing.T) {
+	tests := []struct {
+		entry     string
+		wantHost  remote.Host
+		wantAttrs map[string]string
+		wantErr   bool
+	}{
+		{"1.1.1.1", remote.Host{Address: "1.1.1.1"}, map[string]string{}, false},
+		{"admin@[fe80::1]:22,rack=r1", remote.Host{Address: "fe80::1", User: "admin", Port: 22},
+			map[string]string{"rack": "r1"}, false},
+		{"node1,a=1,b=x=y,c=", remote.Host{Address: "node1"},
+			map[string]string{"a": "1", "b": "x=y", "c": ""}, false},
+		{"node1,rack", remote.Host{}, nil, true},
+		{"node1,=r1", remote.Host{}, nil, true},
+		{"node1,", remote.Host{}, nil, true},
+		{",rack=r1", remote.Host{}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.entry, func(t *testing.T) {
+			h, attrs, err := parseHostEntry(tt.entry)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantHost, h)
+			assert.Equal(t, tt.wantAttrs, attrs)
+		})
+	}
+}
+
+func TestOctopus_Do_fanout(t *testing.T) {
+	allConnects := []string{}
+	for i := 1; i <= 10; i++ {
+		allConnects = append(allConnects, fmt.Sprintf("%d.%d.%d.%d", i, i, i, i))
+	}
+	getAddrsFromGroupsFile = func(hostGroups []string, groupsFile string) ([][]string, error) {
+		return [][]string{allConnects}, nil
+	}
+
+	var running, maxRunning int32
+	var testAction remote.Action = func(a remote.Actor, h *remote.HostInfo) (stdout, stderr *bytes.Buffer, err error) {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return bytes.NewBufferString("stdout okay"), bytes.NewBufferString(""), nil
+	}
+
+	tests := []struct {
+		name          string
+		fanout        uint
+		wantMaxAtOnce int32
+	}{
+		{"fanout 3", 3, 3},
+		{"fanout 1", 1, 1},
+		{"fanout larger than hosts", 50, 10},
+		{"no fanout limit", 0, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			running, maxRunning = 0, 0
+			c := &remotetest.MockRemoteConnector{ReturnActor: &remotetest.MockRemoteActor{}}
+			o := New(c, []string{"all"}, "_test-groups-file", NewOptions(tt.fanout, Batch{}, 0, -1, NewTextReporter(ioutil.Discard, ioutil.Discard), "", false, nil, nil, nil))
+			numHostErrors, err := o.Do(context.Background(), testAction)
+			assert.NoError(t, err)
+			assert.Equal(t, 0, numHostErrors)
+			assert.ElementsMatch(t, allConnects, c.HostConnects)
+			// all hosts sleep long enough that hosts up to the fanout should always overlap
+			assert.Equal(t, tt.wantMaxAtOnce, maxRunning)
+		})
+	}
+}
+
+func TestOctopus_Do_batches(t *testing.T) {
+	allConnects := []string{}
+	for i := 1; i <= 10; i++ {
+		allConnects = append(allConnects, fmt.Sprintf("%d.%d.%d.%d", i, i, i, i))
+	}
+	getAddrsFromGroupsFile = func(hostGroups []string, groupsFile string) ([][]string, error) {
+		return [][]string{allConnects}, nil
+	}
+
+	failHosts := map[string]bool{}
+	var testAction remote.Action = func(a remote.Actor, h *remote.HostInfo) (stdout, stderr *bytes.Buffer, err error) {
+		if failHosts[a.(*remotetest.MockRemoteActor).Hostname] {
+			return bytes.NewBufferString(""), bytes.NewBufferString(""), fmt.Errorf("action(actor) fail")
+		}
+		return bytes.NewBufferString("stdout okay"), bytes.NewBufferString(""), nil
+	}
+
+	tests := []struct {
+		name          string
+		batch         string
+		maxFailures   int
+		failHosts     []string
+		wantConnects  []string
+		numHostErrors int
+	}{
+		{"one batch, no failures", "", 0, []string{}, allConnects, 0},
+		{"batches, no failures", "3", 0, []string{}, allConnects, 0},
+		{"stop after failure in second batch", "3", 0, []string{"5.5.5.5"}, allConnects[:6], 1},
+		{"failures within limit", "3", 1, []string{"1.1.1.1", "5.5.5.5"}, allConnects, 2},
+		{"stop after failures over limit", "40%", 1, []string{"1.1.1.1", "2.2.2.2"}, allConnects[:4], 2},
+		{"never stop", "3", -1, []string{"1.1.1.1", "2.2.2.2", "3.3.3.3"}, allConnects, 3},
+		{"failure in last batch", "3", 0, []string{"10.10.10.10"}, allConnects, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failHosts = map[string]bool{}
+			for _, h := range tt.failHosts {
+				failHosts[h+"-hostname"] = true
+			}
+			batch, err := ParseBatch(tt.batch)
+			assert.NoError(t, err)
+			c := &remotetest.MockRemoteConnector{ReturnActor: &remotetest.MockRemoteActor{}}
+			o := New(c, []string{"all"}, "_test-groups-file", NewOptions(0, batch, time.Millisecond, tt.maxFailures, NewTextReporter(ioutil.Discard, ioutil.Discard), "", false, nil, nil, nil))
+			numHostErrors, err := o.Do(context.Background(), testAction)
+			assert.NoError(t, err)
+			// skipped hosts are not counted as failed hosts
+			assert.Equal(t, tt.numHostErrors, numHostErrors)
+			assert.ElementsMatch(t, tt.wantConnects, c.HostConnects)
+		})
+	}
+}
+
+func TestOctopus_Do_hostInfo(t *testing.T) {
+	getAddrsFromGroupsFile = func(hostGroups []string, groupsFile string) ([][]string, error) {
+		return [][]string{{"1.1.1.1,osd=0", "2.2.2.2,osd=1"}}, nil
+	}
+	var lock sync.Mutex
+	got := map[string]string{}
+	var testAction remote.Action = func(a remote.Actor, h *remote.HostInfo) (stdout, stderr *bytes.Buffer, err error) {
+		lock.Lock()
+		defer lock.Unlock()
+		got[h.Host.String()] = fmt.Sprintf("%s %d %v %s %s", h.Group, h.Index, h.Groups, h.Attrs["osd"], h.Hostname())
+		return bytes.NewBufferString(""), bytes.NewBufferString(""), nil
+	}
+
+	for _, format := range []string{TextFormat, StreamFormat} {
+		t.Run(format, func(t *testing.T) {
+			got = map[string]string{}
+			reporter, err := NewReporter(format, ioutil.Discard, ioutil.Discard)
+			assert.NoError(t, err)
+			c := &remotetest.MockRemoteConnector{ReturnActor: &remotetest.MockRemoteActor{}}
+			o := New(c, []string{"osds"}, "_test-groups-file", NewOptions(0, Batch{}, 0, -1, reporter, "", false, nil, nil, nil))
+			numHostErrors, err := o.Do(context.Background(), testAction)
+			assert.NoError(t, err)
+			assert.Equal(t, 0, numHostErrors)
+			assert.Equal(t, map[string]string{
+				"1.1.1.1": "osds 0 [osds] 0 1.1.1.1-hostname",
+				"2.2.2.2": "osds 1 [osds] 1 2.2.2.2-hostname",
+			}, got)
+		})
+	}
+}
+
+// resultRecorder is a Reporter which keeps all results
+type resultRecorder struct {
+	results []Result
+}
+
+func (r *resultRecorder) Begin(hosts []string) error { return nil }
+func (r *resultRecorder) HostResult(res *Result) error {
+	r.results = append(r.results, *res)
+	return nil
+}
+func (r *resultRecorder) End() error { return nil }
+
+func TestOctopus_Do_interrupted(t *testing.T) {
+	allConnects := []string{"1.1.1.1", "2.2.2.2", "3.3.3.3", "4.4.4.4"}
+	getAddrsFromGroupsFile = func(hostGroups []string, groupsFile string) ([][]string, error) {
+		return [][]string{allConnects}, nil
+	}
+	var testAction remote.Action = func(a remote.Actor, h *remote.HostInfo) (stdout, stderr *bytes.Buffer, err error) {
+		return a.RunCommand("wait for it")
+	}
+
+	tests := []struct {
+		name   string
+		fanout uint
+		batch  string
+	}{
+		{"hosts waiting for fanout", 2, ""},
+		{"hosts in later batches", 0, "2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			batch, err := ParseBatch(tt.batch)
+			assert.NoError(t, err)
+			rec := &resultRecorder{}
+			c := &remotetest.MockRemoteConnector{ReturnActor: &remotetest.MockRemoteActor{WaitOn: "wait"}}
+			// a failure limit of 0 would stop later batches, but interruption is reported instead
+			o := New(c, []string{"all"}, "_test-groups-file", NewOptions(tt.fanout, batch, 0, 0, rec, "", false, nil, nil, nil))
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(50*time.Millisecond, cancel)
+			numHostErrors, err := o.Do(ctx, testAction)
+			assert.Equal(t, ErrInterrupted, err)
+			// skipped hosts are not counted as failed hosts
+			assert.Equal(t, 2, numHostErrors)
+			assert.ElementsMatch(t, allConnects[:2], c.HostConnects)
+
+			interrupted, skipped := []string{}, []string{}
+			for _, r := range rec.results {
+				if r.Skipped {
+					assert.Equal(t, "octopus was interrupted", r.SkipReason)
+					skipped = append(skipped, r.Host)
+					continue
+				}
+				assert.True(t, r.Interrupted)
+				assert.IsType(t, &remote.InterruptedError{}, r.Err)
+				interrupted = append(interrupted, r.Host)
+			}
+			assert.ElementsMatch(t, allConnects[:2], interrupted)
+			assert.ElementsMatch(t, allConnects[2:], skipped)
+		})
+	}
+}
+
+func TestOctopus_DoWithoutConnecting(t *testing.T) {
+	getAddrsFromGroupsFile = func(hostGroups []string, groupsFile string) ([][]string, error) {
+		return [][]string{{"1.1.1.1,osd=0", "2.2.2.2,osd=1"}}, nil
+	}
+	var testAction remote.Action = func(a remote.Actor, h *remote.HostInfo) (stdout, stderr *bytes.Buffer, err error) {
+		assert.Nil(t, a)
+		assert.Nil(t, h.Hostname)
+		if h.Attrs["osd"] == "1" {
+			return bytes.NewBufferString(""), bytes.NewBufferString(""), fmt.Errorf("render fail")
+		}
+		return bytes.NewBufferString("osd " + h.Attrs["osd"] + "\n"), bytes.NewBufferString(""), nil
+	}
+
+	tests := []struct {
+		format     string
+		wantStdout string
+		wantStderr string
+	}{
+		{TextFormat,
+			"~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~\n 1.1.1.1\n~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~\n\nosd 0\n\n",
+			"Error: render fail\n\n"},
+		{StreamFormat, "1.1.1.1: osd 0\n", "2.2.2.2: Error: render fail\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+			reporter, err := NewReporter(tt.format, stdout, stderr)
+			assert.NoError(t, err)
+			c := &remotetest.MockRemoteConnector{}
+			o := New(c, []string{"osds"}, "_test-groups-file",
+				NewOptions(1, Batch{}, 0, -1, reporter, "", false, nil, nil, nil))
+			numHostErrors, err := o.DoWithoutConnecting(context.Background(), testAction)
+			assert.NoError(t, err)
+			assert.Equal(t, 1, numHostErrors)
+			assert.Empty(t, c.HostConnects)
+			assert.Contains(t, stdout.String(), tt.wantStdout)
+			assert.Contains(t, stderr.String(), tt.wantStderr)
+			assert.NotContains(t, stdout.String()+stderr.String(), "could not get hostname")
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package octopus
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// the machine-readable form of a result
+type jsonResult struct {
+	Host        string     `json:"host"`
+	Hostname    string     `json:"hostname"`
+	Stdout      string     `json:"stdout"`
+	Stderr      string     `json:"stderr"`
+	Error       *string    `json:"error"`
+	Connected   bool       `json:"connected"`
+	ExitStatus  *jsonExit  `json:"exit_status"`
+	Skipped     bool       `json:"skipped"`
+	SkipReason  string     `json:"skip_reason,omitempty"`
+	Interrupted bool       `json:"interrupted"`
+	Start       *time.Time `json:"start"`
+	End         *time.Time `json:"end"`
+	Duration    *float64   `json:"duration_seconds"`
+}
+
+// the exit status of an action which ran to completion
+type jsonExit struct {
+	Code   int    `json:"code"`
+	Signal string `json:"signal,omitempty"`
+}
+
+func newJSONResult(r *Result) *jsonResult {
+	j := &jsonResult{
+		Host:        r.Host,
+		Hostname:    r.Hostname,
+		Connected:   r.Connected,
+		Skipped:     r.Skipped,
+		SkipReason:  r.SkipReason,
+		Interrupted: r.Interrupted,
+	}
+	if r.ExitStatus != nil {
+		j.ExitStatus = &jsonExit{Code: r.ExitStatus.Code, Signal: r.ExitStatus.Signal}
+	}
+	// if buffer is nil, (*bytes.Buffer).String() returns "<nil>"; do not output this
+	if r.Stdout != nil {
+		j.Stdout = r.Stdout.String()
+	}
+	if r.Stderr != nil {
+		j.Stderr = r.Stderr.String()
+	}
+	if r.Err != nil {
+		e := fmt.Sprintf("%+v", r.Err)
+		j.Error = &e
+	}
+	// skipped hosts have no start or end
+	if !r.Start.IsZero() && !r.End.IsZero() {
+		start, end := r.Start, r.End
+		d := end.Sub(start).Seconds()
+		j.Start, j.End, j.Duration = &start, &end, &d
+	}
+	return j
+}
+
+// An ndjsonReporter prints each result as a JSON object on one line as soon as it is received.
+type ndjsonReporter struct {
+	out io.Writer
+}
+
+func (n *ndjsonReporter) Begin(hosts []string) error { return nil }
+
+func (n *ndjsonReporter) HostResult(r *Result) error {
+	return json.NewEncoder(n.out).Encode(newJSONResult(r))
+}
+
+func (n *ndjsonReporter) End() error { return nil }
+
+// A jsonReporter prints all results as an array of JSON objects once all hosts have finished.
+type jsonReporter struct {
+	out     io.Writer
+	results []Result
+}
+
+func (j *jsonReporter) Begin(hosts []string) error { return nil }
+
+func (j *jsonReporter) HostResult(r *Result) error {
+	j.results = append(j.results, *r)
+	return nil
+}
+
+func (j *jsonReporter) End() error {
+	js := make([]*jsonResult, 0, len(j.results))
+	for i := range j.results {
+		js = append(js, newJSONResult(&j.results[i]))
+	}
+	e := json.NewEncoder(j.out)
+	e.SetIndent("", "  ")
+	return e.Encode(js)
+}
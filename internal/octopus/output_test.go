@@ -0,0 +1,129 @@
+package octopus
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BlaineEXE/octopus/internal/remote"
+	remotetest "github.com/BlaineEXE/octopus/internal/remote/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_newJSONResult(t *testing.T) {
+	start := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	end := start.Add(1500 * time.Millisecond)
+
+	r := &Result{Host: "admin@10.0.0.5:2222", Hostname: "node1", Start: start, End: end,
+		Stdout: bytes.NewBufferString("out\n"), Stderr: bytes.NewBufferString("err\n"),
+		Err: fmt.Errorf("fail"), Connected: true, ExitStatus: &remote.ExitStatus{Code: 2}}
+	b, err := json.Marshal(newJSONResult(r))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"host": "admin@10.0.0.5:2222",
+		"hostname": "node1",
+		"stdout": "out\n",
+		"stderr": "err\n",
+		"error": "fail",
+		"connected": true,
+		"exit_status": {"code": 2},
+		"skipped": false,
+		"interrupted": false,
+		"start": "2020-01-02T03:04:05Z",
+		"end": "2020-01-02T03:04:06.5Z",
+		"duration_seconds": 1.5
+	}`, string(b))
+
+	r = &Result{Host: "10.0.0.6", Skipped: true, SkipReason: "stopped"}
+	b, err = json.Marshal(newJSONResult(r))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"host": "10.0.0.6",
+		"hostname": "",
+		"stdout": "",
+		"stderr": "",
+		"error": null,
+		"connected": false,
+		"exit_status": null,
+		"skipped": true,
+		"skip_reason": "stopped",
+		"interrupted": false,
+		"start": null,
+		"end": null,
+		"duration_seconds": null
+	}`, string(b))
+
+	r = &Result{Host: "10.0.0.7", Connected: true, ExitStatus: &remote.ExitStatus{Code: -1, Signal: "KILL"}}
+	j := newJSONResult(r)
+	assert.Equal(t, &jsonExit{Code: -1, Signal: "KILL"}, j.ExitStatus)
+}
+
+func TestOctopus_Do_output(t *testing.T) {
+	getAddrsFromGroupsFile = func(hostGroups []string, groupsFile string) ([][]string, error) {
+		return [][]string{{"1.1.1.1", "2.2.2.2", "3.3.3.3"}}, nil
+	}
+	var action remote.Action = func(a remote.Actor, h *remote.HostInfo) (o, e *bytes.Buffer, err error) {
+		return a.RunCommand("cmd")
+	}
+
+	for _, format := range []string{JSONFormat, NDJSONFormat} {
+		t.Run(format, func(t *testing.T) {
+			out := new(bytes.Buffer)
+			reporter, err := NewReporter(format, out, ioutil.Discard)
+			assert.NoError(t, err)
+			c := &remotetest.MockRemoteConnector{
+				ReturnActor:        &remotetest.MockRemoteActor{},
+				ErrorOnConnectHost: "2.2.2.2",
+			}
+			o := New(c, []string{"all"}, "_test-groups-file", NewOptions(0, Batch{}, 0, -1, reporter, "", false, nil, nil, nil))
+			numHostErrors, err := o.Do(context.Background(), action)
+			assert.NoError(t, err)
+			assert.Equal(t, 1, numHostErrors)
+
+			results := []jsonResult{}
+			if format == JSONFormat {
+				assert.NoError(t, json.Unmarshal(out.Bytes(), &results))
+			} else {
+				lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+				for _, l := range lines {
+					r := jsonResult{}
+					assert.NoError(t, json.Unmarshal([]byte(l), &r), l)
+					results = append(results, r)
+				}
+			}
+
+			assert.Len(t, results, 3)
+			for _, r := range results {
+				assert.NotNil(t, r.Start)
+				if r.Host == "2.2.2.2" {
+					assert.Equal(t, "", r.Hostname)
+					assert.Equal(t, "2.2.2.2 fail", *r.Error)
+					// a host which can't be connected to is distinguishable from a command failure
+					assert.False(t, r.Connected)
+					assert.Nil(t, r.ExitStatus)
+					continue
+				}
+				assert.Equal(t, r.Host+"-hostname", r.Hostname)
+				assert.Equal(t, "cmd: stdout ok", r.Stdout)
+				assert.Nil(t, r.Error)
+				assert.True(t, r.Connected)
+				assert.Equal(t, &jsonExit{Code: 0}, r.ExitStatus)
+			}
+		})
+	}
+}
+
+func Test_exitStatus(t *testing.T) {
+	assert.Equal(t, &remote.ExitStatus{Code: 0}, exitStatus(nil))
+	assert.Equal(t, &remote.ExitStatus{Code: 1},
+		exitStatus(&remote.ExitError{Status: remote.ExitStatus{Code: 1}}))
+	assert.Equal(t, &remote.ExitStatus{Code: -1, Signal: "TERM"},
+		exitStatus(&remote.ExitError{Status: remote.ExitStatus{Code: -1, Signal: "TERM"}}))
+	assert.Nil(t, exitStatus(fmt.Errorf("connection lost")))
+	assert.Nil(t, exitStatus(&remote.TimeoutError{Operation: "command", Limit: time.Second}))
+}
@@ -0,0 +1,104 @@
+package octopus
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// An outputDirWriter writes each result to files in a dir:
+//   <name>.stdout - the host's stdout
+//   <name>.stderr - the host's stderr
+//   <name>.status - a short summary of how the action on the host went
+// The name is the host's hostname, or the host itself if the hostname could not be gotten.
+type outputDirWriter struct {
+	dir  string
+	used map[string]bool // names already used, so hosts with the same hostname don't collide
+}
+
+func newOutputDirWriter(dir string) (*outputDirWriter, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create output dir %s. %+v", dir, err)
+	}
+	return &outputDirWriter{
+		dir:  dir,
+		used: map[string]bool{},
+	}, nil
+}
+
+// Path separators and NUL are the only characters which can't appear in file names on Linux. Names
+// which are empty or only dots (e.g., "..") refer to dirs, so they are prefixed to be plain names.
+func safeFileName(s string) string {
+	s = strings.NewReplacer("/", "_", "\x00", "_").Replace(s)
+	if strings.Trim(s, ".") == "" {
+		s = "_" + s
+	}
+	return s
+}
+
+func (w *outputDirWriter) name(r *Result) string {
+	name := safeFileName(r.id())
+	if w.used[name] {
+		name = name + "_" + safeFileName(r.Host)
+	}
+	for base, i := name, 2; w.used[name]; i++ {
+		name = fmt.Sprintf("%s_%d", base, i)
+	}
+	w.used[name] = true
+	return name
+}
+
+func (w *outputDirWriter) write(r *Result) error {
+	name := w.name(r)
+	base := filepath.Join(w.dir, name)
+	// names come from hosts, so make sure a bad name can never write outside of the dir
+	if filepath.Dir(base) != filepath.Clean(w.dir) {
+		return fmt.Errorf("output file name %q for host %s is not in output dir %s", name, r.Host, w.dir)
+	}
+	if !r.Skipped {
+		// hosts which could not be connected to have nil buffers, but still get empty files
+		for ext, buf := range map[string]*bytes.Buffer{".stdout": r.Stdout, ".stderr": r.Stderr} {
+			b := []byte{}
+			if buf != nil {
+				b = buf.Bytes()
+			}
+			if err := ioutil.WriteFile(base+ext, b, 0644); err != nil {
+				return err
+			}
+		}
+	}
+	return ioutil.WriteFile(base+".status", []byte(statusText(r)), 0644)
+}
+
+// a short summary of the result with one "key: value" per line
+func statusText(r *Result) string {
+	lines := []string{
+		"host: " + r.Host,
+		"hostname: " + r.Hostname,
+	}
+	if r.Skipped {
+		lines = append(lines, "skipped: "+r.SkipReason)
+		return strings.Join(lines, "\n") + "\n"
+	}
+	lines = append(lines, fmt.Sprintf("connected: %t", r.Connected))
+	if r.ExitStatus != nil {
+		lines = append(lines, fmt.Sprintf("exit code: %d", r.ExitStatus.Code))
+		if r.ExitStatus.Signal != "" {
+			lines = append(lines, "signal: "+r.ExitStatus.Signal)
+		}
+	}
+	if r.Err != nil {
+		// keep the error on one line so the file stays easy to parse
+		lines = append(lines, "error: "+strings.ReplaceAll(fmt.Sprintf("%+v", r.Err), "\n", " "))
+	}
+	lines = append(lines,
+		"start: "+r.Start.Format(time.RFC3339Nano),
+		"end: "+r.End.Format(time.RFC3339Nano),
+		"duration: "+r.End.Sub(r.Start).String(),
+	)
+	return strings.Join(lines, "\n") + "\n"
+}
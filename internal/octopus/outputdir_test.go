@@ -0,0 +1,126 @@
+package octopus
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/BlaineEXE/octopus/internal/remote"
+	"github.com/BlaineEXE/octopus/internal/util/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_outputDirWriter(t *testing.T) {
+	tmpRoot, cleanup := testutil.TempDir("")
+	defer cleanup()
+	dir := path.Join(tmpRoot, "out", "latest")
+
+	w, err := newOutputDirWriter(dir)
+	assert.NoError(t, err)
+
+	start := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	end := start.Add(2 * time.Second)
+	bs := bytes.NewBufferString
+	results := []Result{
+		{Host: "10.0.0.1", Hostname: "node1", Stdout: bs("out1\n"), Stderr: bs("err1\n"),
+			Connected: true, ExitStatus: &remote.ExitStatus{Code: 0}, Start: start, End: end},
+		{Host: "10.0.0.2", Hostname: "", Err: fmt.Errorf("could not\nconnect"), Start: start, End: end},
+		// same hostname as another host
+		{Host: "10.0.0.3", Hostname: "node1", Stdout: bs(""), Stderr: bs("killed\n"), Err: fmt.Errorf("killed"),
+			Connected: true, ExitStatus: &remote.ExitStatus{Code: -1, Signal: "KILL"}, Start: start, End: end},
+		{Host: "admin@10.0.0.4", Skipped: true, SkipReason: "stopped"},
+	}
+	for i := range results {
+		assert.NoError(t, w.write(&results[i]))
+	}
+
+	read := func(name string) string {
+		b, err := ioutil.ReadFile(path.Join(dir, name))
+		assert.NoError(t, err, name)
+		return string(b)
+	}
+	assert.Equal(t, "out1\n", read("node1.stdout"))
+	assert.Equal(t, "err1\n", read("node1.stderr"))
+	assert.Equal(t, `host: 10.0.0.1
+hostname: node1
+connected: true
+exit code: 0
+start: 2020-01-02T03:04:05Z
+end: 2020-01-02T03:04:07Z
+duration: 2s
+`, read("node1.status"))
+
+	assert.Equal(t, "", read("10.0.0.2.stdout"))
+	assert.Equal(t, "", read("10.0.0.2.stderr"))
+	assert.Equal(t, `host: 10.0.0.2
+hostname: 
+connected: false
+error: could not connect
+start: 2020-01-02T03:04:05Z
+end: 2020-01-02T03:04:07Z
+duration: 2s
+`, read("10.0.0.2.status"))
+
+	assert.Equal(t, "killed\n", read("node1_10.0.0.3.stderr"))
+	assert.Contains(t, read("node1_10.0.0.3.status"), "exit code: -1\nsignal: KILL\nerror: killed\n")
+
+	assert.Equal(t, "host: admin@10.0.0.4\nhostname: \nskipped: stopped\n", read("admin@10.0.0.4.status"))
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 10)
+}
+
+func Test_outputDirWriter_name(t *testing.T) {
+	w := &outputDirWriter{used: map[string]bool{}}
+	assert.Equal(t, "node1", w.name(&Result{Host: "1.1.1.1", Hostname: "node1"}))
+	assert.Equal(t, "node1_2.2.2.2", w.name(&Result{Host: "2.2.2.2", Hostname: "node1"}))
+	assert.Equal(t, "node1_2.2.2.2_2", w.name(&Result{Host: "2.2.2.2", Hostname: "node1"}))
+	assert.Equal(t, "a_b", w.name(&Result{Host: "3.3.3.3", Hostname: "a/b"}))
+}
+
+func Test_safeFileName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"node1", "node1"},
+		{"a/b", "a_b"},
+		{"nul\x00byte", "nul_byte"},
+		{"", "_"},
+		{".", "_."},
+		{"..", "_.."},
+		{"../..", ".._.."},
+		{".hidden", ".hidden"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%q", tt.name), func(t *testing.T) {
+			assert.Equal(t, tt.want, safeFileName(tt.name))
+		})
+	}
+}
+
+func Test_outputDirWriter_dotNames(t *testing.T) {
+	tmpRoot, cleanup := testutil.TempDir("")
+	defer cleanup()
+	dir := path.Join(tmpRoot, "out")
+	w, err := newOutputDirWriter(dir)
+	assert.NoError(t, err)
+
+	// hostnames reported by hosts could try to write outside of the dir
+	for _, hostname := range []string{"", ".", ".."} {
+		r := &Result{Host: "", Hostname: hostname, Connected: true,
+			Stdout: bytes.NewBufferString("out"), Stderr: bytes.NewBufferString("")}
+		assert.NoError(t, w.write(r), "hostname %q", hostname)
+	}
+	files, err := ioutil.ReadDir(tmpRoot)
+	assert.NoError(t, err)
+	if assert.Len(t, files, 1) {
+		assert.Equal(t, "out", files[0].Name())
+	}
+	files, err = ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 9)
+}
@@ -0,0 +1,156 @@
+package octopus
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Kinds of report files which can be written after all hosts have finished.
+const (
+	// JUnitReport writes a JUnit XML file with one testcase per host.
+	JUnitReport = "junit"
+)
+
+// ReportKinds is the list of valid report kinds.
+var ReportKinds = []string{JUnitReport}
+
+// A Report is a file written with all hosts' results once all hosts have finished.
+type Report struct {
+	kind string // one of ReportKinds
+	path string
+}
+
+// ParseReport parses a report given as "<kind>=<path>" (e.g., "junit=results.xml").
+func ParseReport(s string) (Report, error) {
+	kv := strings.SplitN(s, "=", 2)
+	if len(kv) != 2 || kv[1] == "" {
+		return Report{}, fmt.Errorf("report %q is not of the form <kind>=<path>", s)
+	}
+	for _, k := range ReportKinds {
+		if kv[0] == k {
+			return Report{kind: kv[0], path: kv[1]}, nil
+		}
+	}
+	return Report{}, fmt.Errorf("report kind %q is not one of %v", kv[0], ReportKinds)
+}
+
+func (r Report) String() string {
+	return r.kind + "=" + r.path
+}
+
+func (r Report) write(suite string, results []Result, total time.Duration) error {
+	switch r.kind {
+	case JUnitReport:
+		return writeJUnit(r.path, suite, results, total)
+	default:
+		return fmt.Errorf("unknown report kind %q", r.kind)
+	}
+}
+
+// JUnit XML schema as understood by most CI systems
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr,omitempty"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure"`
+	Skipped   *junitMessage `xml:"skipped"`
+	SystemOut string        `xml:"system-out,omitempty"`
+	SystemErr string        `xml:"system-err,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// build a JUnit test suite from the results; each host is a testcase named with its hostname (or
+// the host if the hostname is not known) in a class named after the suite
+func newJUnitTestSuite(suite string, results []Result, total time.Duration) junitTestSuite {
+	s := junitTestSuite{
+		Name:  suite,
+		Tests: len(results),
+		Time:  seconds(total),
+		Cases: make([]junitTestCase, 0, len(results)),
+	}
+	start := time.Time{}
+	for i := range results {
+		r := &results[i]
+		c := junitTestCase{
+			Name:      r.id(),
+			ClassName: suite,
+			Time:      seconds(0),
+		}
+		if !r.Start.IsZero() {
+			c.Time = seconds(r.End.Sub(r.Start))
+			if start.IsZero() || r.Start.Before(start) {
+				start = r.Start
+			}
+		}
+		if r.Stdout != nil {
+			c.SystemOut = r.Stdout.String()
+		}
+		if r.Stderr != nil {
+			c.SystemErr = r.Stderr.String()
+		}
+		switch {
+		case r.Skipped:
+			c.Skipped = &junitMessage{Message: r.SkipReason}
+			s.Skipped++
+		case r.Err != nil:
+			msg := fmt.Sprintf("%+v", r.Err)
+			c.Failure = &junitMessage{Message: msg, Type: failureKind(r), Text: msg}
+			s.Failures++
+		}
+		s.Cases = append(s.Cases, c)
+	}
+	if !start.IsZero() {
+		s.Timestamp = start.Format("2006-01-02T15:04:05")
+	}
+	return s
+}
+
+func writeJUnit(path, suite string, results []Result, total time.Duration) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create junit report %s. %+v", path, err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(xml.Header); err != nil {
+		return fmt.Errorf("failed to write junit report %s. %+v", path, err)
+	}
+	e := xml.NewEncoder(f)
+	e.Indent("", "  ")
+	ts := junitTestSuites{Suites: []junitTestSuite{newJUnitTestSuite(suite, results, total)}}
+	if err := e.Encode(ts); err != nil {
+		return fmt.Errorf("failed to write junit report %s. %+v", path, err)
+	}
+	if _, err := f.WriteString("\n"); err != nil {
+		return fmt.Errorf("failed to write junit report %s. %+v", path, err)
+	}
+	return f.Close()
+}
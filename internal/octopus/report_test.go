@@ -0,0 +1,112 @@
+package octopus
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BlaineEXE/octopus/internal/remote"
+	"github.com/BlaineEXE/octopus/internal/util/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseReport(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    Report
+		wantErr bool
+	}{
+		{"junit", "junit=results.xml", Report{kind: JUnitReport, path: "results.xml"}, false},
+		{"path with equals", "junit=a=b.xml", Report{kind: JUnitReport, path: "a=b.xml"}, false},
+		{"no path", "junit=", Report{}, true},
+		{"no kind", "results.xml", Report{}, true},
+		{"unknown kind", "tap=results.tap", Report{}, true},
+		{"empty", "", Report{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseReport(tt.s)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_writeJUnit(t *testing.T) {
+	dir, cleanup := testutil.TempDir("octopus-report-test-")
+	defer cleanup()
+
+	start := time.Date(2019, 3, 4, 5, 6, 7, 0, time.UTC)
+	results := []Result{
+		{Host: "10.0.0.1", Hostname: "node1", Start: start, End: start.Add(1500 * time.Millisecond),
+			Stdout: bytes.NewBufferString("hello\n"), Stderr: &bytes.Buffer{}, Connected: true},
+		{Host: "10.0.0.2", Hostname: "node2", Start: start.Add(time.Second), End: start.Add(2 * time.Second),
+			Stdout: &bytes.Buffer{}, Stderr: bytes.NewBufferString("oops <&>\n"), Connected: true,
+			Err: &remote.ExitError{Status: remote.ExitStatus{Code: 3}}},
+		{Host: "10.0.0.3", Start: start, End: start.Add(time.Second),
+			Err: fmt.Errorf("failed to dial host")},
+		{Host: "10.0.0.4", Skipped: true, SkipReason: "too many failures"},
+	}
+
+	p := path.Join(dir, "results.xml")
+	r, err := ParseReport("junit=" + p)
+	assert.NoError(t, err)
+	assert.NoError(t, r.write("group1,group2", results, 3*time.Second))
+
+	b, err := ioutil.ReadFile(p)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(b), xml.Header))
+
+	got := junitTestSuites{}
+	assert.NoError(t, xml.Unmarshal(b, &got))
+	assert.Len(t, got.Suites, 1)
+	s := got.Suites[0]
+	assert.Equal(t, "group1,group2", s.Name)
+	assert.Equal(t, 4, s.Tests)
+	assert.Equal(t, 2, s.Failures)
+	assert.Equal(t, 0, s.Errors)
+	assert.Equal(t, 1, s.Skipped)
+	assert.Equal(t, "3.000", s.Time)
+	assert.Equal(t, "2019-03-04T05:06:07", s.Timestamp)
+	assert.Len(t, s.Cases, 4)
+
+	c := s.Cases[0]
+	assert.Equal(t, "node1", c.Name)
+	assert.Equal(t, "group1,group2", c.ClassName)
+	assert.Equal(t, "1.500", c.Time)
+	assert.Equal(t, "hello\n", c.SystemOut)
+	assert.Equal(t, "", c.SystemErr)
+	assert.Nil(t, c.Failure)
+	assert.Nil(t, c.Skipped)
+
+	c = s.Cases[1]
+	assert.Equal(t, "node2", c.Name)
+	assert.Equal(t, "oops <&>\n", c.SystemErr)
+	assert.Equal(t, &junitMessage{Message: "command exited with status 3", Type: exitFailure,
+		Text: "command exited with status 3"}, c.Failure)
+
+	c = s.Cases[2]
+	assert.Equal(t, "10.0.0.3", c.Name)
+	assert.Equal(t, connectFailure, c.Failure.Type)
+
+	c = s.Cases[3]
+	assert.Equal(t, "10.0.0.4", c.Name)
+	assert.Equal(t, "0.000", c.Time)
+	assert.Nil(t, c.Failure)
+	assert.Equal(t, &junitMessage{Message: "too many failures"}, c.Skipped)
+}
+
+func Test_writeJUnit_badPath(t *testing.T) {
+	err := writeJUnit("/this/dir/does/not/exist/results.xml", "all", []Result{}, 0)
+	assert.Error(t, err)
+}
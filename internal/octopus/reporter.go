@@ -0,0 +1,153 @@
+package octopus
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// A Reporter outputs the results of an octopus's action as it operates on hosts.
+type Reporter interface {
+	// Begin is called once with all hosts before any host is operated on.
+	Begin(hosts []string) error
+
+	// HostResult is called with each host's result as soon as the host is finished or skipped.
+	// It is never called concurrently.
+	HostResult(r *Result) error
+
+	// End is called once after all hosts have finished or been skipped.
+	End() error
+}
+
+// Formats in which results can be reported.
+const (
+	// TextFormat prints each result in a human-readable format headed by a banner with the hostname.
+	TextFormat = "text"
+	// CollateFormat prints identical results once for all hosts which have them after all hosts have
+	// finished, headed by a compact host list.
+	CollateFormat = "collate"
+	// StreamFormat prints each line of command output as soon as it is received, prefixed with the
+	// hostname.
+	StreamFormat = "stream"
+	// JSONFormat prints all results as a single JSON array once all hosts have finished.
+	JSONFormat = "json"
+	// NDJSONFormat prints each result as a JSON object on its own line as soon as the host finishes.
+	NDJSONFormat = "ndjson"
+	// NoFormat prints no results, e.g., when results are only written to an output dir.
+	NoFormat = "none"
+)
+
+// Formats is the list of valid report formats.
+var Formats = []string{TextFormat, CollateFormat, StreamFormat, JSONFormat, NDJSONFormat, NoFormat}
+
+// NewReporter returns a reporter which reports results in the given format, writing main output to
+// stdout and error output to stderr.
+func NewReporter(format string, stdout, stderr io.Writer) (Reporter, error) {
+	switch format {
+	case TextFormat:
+		return NewTextReporter(stdout, stderr), nil
+	case CollateFormat:
+		return &collateReporter{text: NewTextReporter(stdout, stderr), results: []Result{}}, nil
+	case StreamFormat:
+		return &streamReporter{stdout: stdout, stderr: stderr}, nil
+	case JSONFormat:
+		return &jsonReporter{out: stdout, results: []Result{}}, nil
+	case NDJSONFormat:
+		return &ndjsonReporter{out: stdout}, nil
+	case NoFormat:
+		return noReporter{}, nil
+	default:
+		return nil, fmt.Errorf("format %q is not one of %v", format, Formats)
+	}
+}
+
+// A TextReporter prints each result in a nice human readable format as soon as it is received,
+// printing main output to stdout and error output to stderr.
+type TextReporter struct {
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// NewTextReporter returns a reporter which prints results in text format to the given writers.
+func NewTextReporter(stdout, stderr io.Writer) *TextReporter {
+	return &TextReporter{
+		stdout: stdout,
+		stderr: stderr,
+	}
+}
+
+// Begin does nothing since results are printed as they are received.
+func (t *TextReporter) Begin(hosts []string) error { return nil }
+
+// HostResult prints the result headed by a banner with the host's name.
+func (t *TextReporter) HostResult(r *Result) error {
+	return t.print(r, r.name())
+}
+
+// End does nothing since results are printed as they are received.
+func (t *TextReporter) End() error { return nil }
+
+func (t *TextReporter) print(r *Result, name string) error {
+	out := &errWriter{w: t.stdout}
+	errOut := &errWriter{w: t.stderr}
+	fmt.Fprintf(out, "~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~\n")
+	fmt.Fprintf(out, " %s\n", name)
+	fmt.Fprintf(out, "~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~\n\n")
+	if r.Skipped {
+		fmt.Fprintf(errOut, "Skipped: %s\n\n", r.SkipReason) // to stderr
+		return firstErr(out.err, errOut.err)
+	}
+	// if buffer is nil, (*bytes.Buffer).String() returns "<nil>"; do not print this
+	o := strings.TrimRight(r.Stdout.String(), "\n")
+	if r.Stdout != nil && o != "" {
+		fmt.Fprintf(out, "%s\n\n", o)
+	}
+	o = strings.TrimRight(r.Stderr.String(), "\n")
+	if r.Stderr != nil && o != "" {
+		fmt.Fprintf(errOut, "Stderr:\n\n%s\n\n", o) // to stderr
+	}
+	if r.Err != nil {
+		fmt.Fprintf(errOut, "%s: %+v\n\n", errLabel(r), r.Err) // to stderr
+	}
+	return firstErr(out.err, errOut.err)
+}
+
+// the label for the result's error
+func errLabel(r *Result) string {
+	if r.Interrupted {
+		return "Interrupted"
+	}
+	return "Error"
+}
+
+// a noReporter reports nothing
+type noReporter struct{}
+
+func (noReporter) Begin(hosts []string) error { return nil }
+func (noReporter) HostResult(r *Result) error { return nil }
+func (noReporter) End() error                 { return nil }
+
+// An errWriter remembers the first error from its writer and writes nothing after it so that a
+// series of writes can be checked for errors once at the end.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (e *errWriter) Write(p []byte) (int, error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+	var n int
+	n, e.err = e.w.Write(p)
+	return n, e.err
+}
+
+func firstErr(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package octopus
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/BlaineEXE/octopus/internal/remote"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewReporter(t *testing.T) {
+	for _, f := range Formats {
+		r, err := NewReporter(f, new(bytes.Buffer), new(bytes.Buffer))
+		assert.NoError(t, err, f)
+		assert.NotNil(t, r, f)
+	}
+	_, err := NewReporter("yaml", new(bytes.Buffer), new(bytes.Buffer))
+	assert.Error(t, err)
+}
+
+func TestTextReporter(t *testing.T) {
+	bs := bytes.NewBufferString
+	tests := []struct {
+		name       string
+		result     Result
+		wantStdout string
+		wantStderr string
+	}{
+		{"success",
+			Result{Host: "1.1.1.1", Hostname: "node1", Stdout: bs("hello\n\n"), Stderr: bs("")},
+			"~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~\n node1\n~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~\n\n" +
+				"hello\n\n",
+			""},
+		{"failure",
+			Result{Host: "1.1.1.1", Hostname: "node1", Stdout: bs(""), Stderr: bs("oops\n"),
+				Err: fmt.Errorf("exit 1")},
+			"~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~\n node1\n~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~\n\n",
+			"Stderr:\n\noops\n\nError: exit 1\n\n"},
+		{"not connected",
+			Result{Host: "1.1.1.2", Err: fmt.Errorf("no route to host")},
+			"~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~\n 1.1.1.2: could not get hostname\n" +
+				"~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~\n\n",
+			"Error: no route to host\n\n"},
+		{"interrupted",
+			Result{Host: "1.1.1.1", Hostname: "node1", Stdout: bs("partial\n"), Stderr: bs(""),
+				Err: &remote.InterruptedError{Operation: "command"}, Interrupted: true},
+			"~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~\n node1\n~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~\n\n" +
+				"partial\n\n",
+			"Interrupted: command was interrupted\n\n"},
+		{"skipped",
+			Result{Host: "1.1.1.3", Skipped: true, SkipReason: "stopped"},
+			"~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~\n 1.1.1.3\n~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~\n\n",
+			"Skipped: stopped\n\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+			r := NewTextReporter(stdout, stderr)
+			assert.NoError(t, r.Begin([]string{tt.result.Host}))
+			assert.NoError(t, r.HostResult(&tt.result))
+			assert.NoError(t, r.End())
+			assert.Equal(t, tt.wantStdout, stdout.String())
+			assert.Equal(t, tt.wantStderr, stderr.String())
+		})
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) { return 0, fmt.Errorf("disk full") }
+
+func TestTextReporter_writeError(t *testing.T) {
+	r := NewTextReporter(failingWriter{}, new(bytes.Buffer))
+	err := r.HostResult(&Result{Hostname: "node1", Stdout: bytes.NewBufferString("hello")})
+	assert.EqualError(t, err, "disk full")
+}
+
+func Test_collateReporter(t *testing.T) {
+	bs := bytes.NewBufferString
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	r, err := NewReporter(CollateFormat, stdout, stderr)
+	assert.NoError(t, err)
+	assert.NoError(t, r.Begin([]string{"1.1.1.1", "1.1.1.2", "1.1.1.3"}))
+	assert.NoError(t, r.HostResult(&Result{Hostname: "node2", Stdout: bs("4.19\n"), Stderr: bs("")}))
+	assert.NoError(t, r.HostResult(&Result{Hostname: "node1", Stdout: bs("4.19\n"), Stderr: bs("")}))
+	assert.NoError(t, r.HostResult(&Result{Hostname: "node3", Stdout: bs("5.4\n"), Stderr: bs("")}))
+	// nothing is printed until all hosts have finished
+	assert.Equal(t, "", stdout.String())
+	assert.NoError(t, r.End())
+	assert.Equal(t,
+		"~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~\n node[1-2]\n~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~\n\n"+
+			"4.19\n\n"+
+			"~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~\n node3\n~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~\n\n"+
+			"5.4\n\n",
+		stdout.String())
+	assert.Equal(t, "", stderr.String())
+}
+
+func Test_noReporter(t *testing.T) {
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	r, err := NewReporter(NoFormat, stdout, stderr)
+	assert.NoError(t, err)
+	assert.NoError(t, r.HostResult(&Result{Hostname: "node1", Stdout: bytes.NewBufferString("hi")}))
+	assert.NoError(t, r.End())
+	assert.Equal(t, "", stdout.String()+stderr.String())
+}
@@ -3,36 +3,67 @@ package octopus
 import (
 	"bytes"
 	"fmt"
-	"os"
-	"strings"
+	"time"
+
+	"github.com/BlaineEXE/octopus/internal/remote"
 )
 
 // Result is the result of an action. The result includes the hostname of the target to
-// better help the user identify in human-readable format which host the result is from. The result
-// also includes information needed to report success and failure conditions.
+// better help the user identify in human-readable format which host the result is from. The
+// hostname is empty if it could not be gotten. The result also includes information needed to
+// report success and failure conditions and when the action started and ended. Results for hosts
+// which could not be connected to are not Connected. Results for actions which ran to completion
+// have an ExitStatus; this is nil if the action did not run or did not finish (e.g., timed out).
+// Hosts which were never reached (e.g., because a rollout was stopped) are reported as skipped and
+// have no output and no error. Results for which output was already streamed to the user are
+// identified by their host if their hostname is not known. Results with errors from actions which
+// were stopped because the octopus was interrupted are Interrupted. Results for actions done
+// without connecting to hosts are Local, have no ExitStatus, and are identified by their host.
 type Result struct {
-	Hostname string
-	Stdout   *bytes.Buffer
-	Stderr   *bytes.Buffer
-	Err      error
+	Host        string // the host target as given in the host groups file
+	Hostname    string
+	Start       time.Time
+	End         time.Time
+	Stdout      *bytes.Buffer
+	Stderr      *bytes.Buffer
+	Err         error
+	Connected   bool
+	ExitStatus  *remote.ExitStatus
+	Skipped     bool
+	SkipReason  string
+	Streamed    bool
+	Interrupted bool
+	Local       bool
 }
 
-// Print outputs a result in a nice human readable format, printing main output to stdout
-// and error output to stderr.
-func (r *Result) Print() {
-	fmt.Printf("~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~\n")
-	fmt.Printf(" %s\n", r.Hostname)
-	fmt.Printf("~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~\n\n")
-	// if buffer is nil, (*bytes.Buffer).String() returns "<nil>"; do not print this
-	o := strings.TrimRight(r.Stdout.String(), "\n")
-	if r.Stdout != nil && o != "" {
-		fmt.Printf("%s\n\n", o)
+// the name by which the host is identified to the user
+func (r *Result) name() string {
+	if r.Hostname != "" {
+		return r.Hostname
+	}
+	if r.Streamed || r.Skipped || r.Local {
+		return r.Host
 	}
-	o = strings.TrimRight(r.Stderr.String(), "\n")
-	if r.Stderr != nil && o != "" {
-		fmt.Fprintf(os.Stderr, "Stderr:\n\n%s\n\n", o) // to stderr
+	// include the raw host (e.g., IP) for some ability to identify the host
+	return fmt.Sprintf("%s: could not get hostname", r.Host)
+}
+
+// the hostname if it is known, or the host otherwise
+func (r *Result) id() string {
+	if r.Hostname != "" {
+		return r.Hostname
+	}
+	return r.Host
+}
+
+// get the exit status of a finished action from its error
+func exitStatus(err error) *remote.ExitStatus {
+	if err == nil {
+		return &remote.ExitStatus{Code: 0}
 	}
-	if r.Err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %+v\n\n", r.Err) // to stderr
+	if e, ok := err.(*remote.ExitError); ok {
+		s := e.Status
+		return &s
 	}
+	return nil
 }
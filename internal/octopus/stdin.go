@@ -0,0 +1,154 @@
+package octopus
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/BlaineEXE/octopus/internal/remote"
+)
+
+// A stdinBuffer copies local stdin to a temporary file as it is received so that every remote
+// command can read all of it from the beginning, no matter when the command starts, without
+// holding all of it in memory.
+type stdinBuffer struct {
+	file *os.File
+
+	lock sync.Mutex
+	cond *sync.Cond // signaled when more data is available or when there will be no more
+	size int64      // bytes written to the file so far
+	done bool       // all of stdin has been written, or reading it failed
+	err  error      // error reading or buffering stdin
+}
+
+func newStdinBuffer(src io.Reader) (*stdinBuffer, error) {
+	f, err := ioutil.TempFile("", "octopus-stdin-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file for stdin. %+v", err)
+	}
+	// the file stays usable until it is closed, and it can't be left behind if octopus is killed
+	if err := os.Remove(f.Name()); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to unlink temporary file for stdin. %+v", err)
+	}
+	b := &stdinBuffer{file: f}
+	b.cond = sync.NewCond(&b.lock)
+	go b.copy(src)
+	return b, nil
+}
+
+func (b *stdinBuffer) copy(src io.Reader) {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			if _, werr := b.file.Write(buf[:n]); werr != nil && err == nil {
+				err = fmt.Errorf("failed to buffer stdin. %+v", werr)
+			}
+			b.lock.Lock()
+			b.size += int64(n)
+			b.cond.Broadcast()
+			b.lock.Unlock()
+		}
+		if err != nil {
+			b.lock.Lock()
+			b.done = true
+			if err != io.EOF {
+				b.err = err
+			}
+			b.cond.Broadcast()
+			b.lock.Unlock()
+			return
+		}
+	}
+}
+
+// NewReader returns a reader which reads all of stdin from the beginning. Reads wait for more of
+// stdin to be received until all of it has been read. The reader must be closed when it is no
+// longer needed so that any waiting read returns.
+func (b *stdinBuffer) NewReader() io.ReadCloser {
+	return &stdinReader{buf: b}
+}
+
+// Close releases the buffer's temporary file. Readers cannot be read after the buffer is closed.
+func (b *stdinBuffer) Close() error {
+	return b.file.Close()
+}
+
+type stdinReader struct {
+	buf    *stdinBuffer
+	off    int64
+	closed bool // protected by the buffer's lock
+}
+
+func (r *stdinReader) Read(p []byte) (int, error) {
+	b := r.buf
+	b.lock.Lock()
+	for !r.closed && !b.done && r.off >= b.size {
+		b.cond.Wait()
+	}
+	closed, size, err := r.closed, b.size, b.err
+	b.lock.Unlock()
+
+	if closed {
+		return 0, io.EOF
+	}
+	if r.off >= size {
+		if err != nil {
+			return 0, err
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > size-r.off {
+		p = p[:size-r.off]
+	}
+	n, err := b.file.ReadAt(p, r.off)
+	r.off += int64(n)
+	if err == io.EOF && n == len(p) {
+		err = nil
+	}
+	return n, err
+}
+
+func (r *stdinReader) Close() error {
+	r.buf.lock.Lock()
+	defer r.buf.lock.Unlock()
+	r.closed = true
+	r.buf.cond.Broadcast()
+	return nil
+}
+
+// A stdinActor sends all of local stdin to every command it runs. Other actor tasks are done by
+// the wrapped actor.
+type stdinActor struct {
+	remote.Actor
+	stdin *stdinBuffer
+}
+
+func newStdinActor(a remote.Actor, stdin *stdinBuffer) *stdinActor {
+	return &stdinActor{
+		Actor: a,
+		stdin: stdin,
+	}
+}
+
+func (a *stdinActor) RunCommand(command string) (stdout, stderr *bytes.Buffer, err error) {
+	stdout = new(bytes.Buffer)
+	stderr = new(bytes.Buffer)
+	err = a.StreamCommand(&remote.Command{Command: command, Stdout: stdout, Stderr: stderr})
+	return
+}
+
+func (a *stdinActor) StreamCommand(c *remote.Command) error {
+	if c.Stdin != nil {
+		return a.Actor.StreamCommand(c)
+	}
+	r := a.stdin.NewReader()
+	defer r.Close() // stop sending stdin if the command finishes without reading all of it
+	withStdin := *c
+	withStdin.Stdin = r
+	return a.Actor.StreamCommand(&withStdin)
+}
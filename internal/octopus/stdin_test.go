@@ -0,0 +1,132 @@
+package octopus
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BlaineEXE/octopus/internal/remote"
+	remotetest "github.com/BlaineEXE/octopus/internal/remote/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_stdinBuffer(t *testing.T) {
+	input := strings.Repeat("0123456789abcdef", 10*1024) // larger than one copy buffer
+	b, err := newStdinBuffer(strings.NewReader(input))
+	assert.NoError(t, err)
+	defer b.Close()
+
+	// readers all get everything from the beginning, including readers created later
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := b.NewReader()
+			defer r.Close()
+			got, err := ioutil.ReadAll(r)
+			assert.NoError(t, err)
+			assert.Equal(t, input, string(got))
+		}()
+	}
+	wg.Wait()
+
+	r := b.NewReader()
+	got, err := ioutil.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, input, string(got))
+}
+
+func Test_stdinBuffer_waitsForInput(t *testing.T) {
+	pr, pw := io.Pipe()
+	b, err := newStdinBuffer(pr)
+	assert.NoError(t, err)
+	defer b.Close()
+
+	r := b.NewReader()
+	done := make(chan string)
+	go func() {
+		got, err := ioutil.ReadAll(r)
+		assert.NoError(t, err)
+		done <- string(got)
+	}()
+
+	pw.Write([]byte("first\n"))
+	time.Sleep(10 * time.Millisecond)
+	pw.Write([]byte("second\n"))
+	select {
+	case <-done:
+		t.Fatal("reader returned before local stdin was closed")
+	case <-time.After(10 * time.Millisecond):
+	}
+	pw.Close()
+	assert.Equal(t, "first\nsecond\n", <-done)
+}
+
+func Test_stdinBuffer_closeReader(t *testing.T) {
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	b, err := newStdinBuffer(pr)
+	assert.NoError(t, err)
+	defer b.Close()
+
+	// closing a reader stops a read which is waiting for stdin which may never come
+	r := b.NewReader()
+	done := make(chan error)
+	go func() {
+		_, err := r.Read(make([]byte, 10))
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	r.Close()
+	assert.Equal(t, io.EOF, <-done)
+}
+
+func Test_stdinBuffer_readError(t *testing.T) {
+	pr, pw := io.Pipe()
+	b, err := newStdinBuffer(pr)
+	assert.NoError(t, err)
+	defer b.Close()
+
+	pw.Write([]byte("partial"))
+	pw.CloseWithError(fmt.Errorf("stdin broke"))
+	got, err := ioutil.ReadAll(b.NewReader())
+	assert.Equal(t, "partial", string(got))
+	assert.EqualError(t, err, "stdin broke")
+}
+
+func TestOctopus_Do_stdin(t *testing.T) {
+	getAddrsFromGroupsFile = func(hostGroups []string, groupsFile string) ([][]string, error) {
+		return [][]string{{"1.1.1.1", "2.2.2.2", "3.3.3.3"}}, nil
+	}
+	var action remote.Action = func(a remote.Actor, h *remote.HostInfo) (o, e *bytes.Buffer, err error) {
+		a.RunCommand("first")
+		return a.RunCommand("second")
+	}
+
+	for _, format := range []string{TextFormat, StreamFormat} {
+		t.Run(format, func(t *testing.T) {
+			reporter, err := NewReporter(format, ioutil.Discard, ioutil.Discard)
+			assert.NoError(t, err)
+			c := &remotetest.MockRemoteConnector{ReturnActor: &remotetest.MockRemoteActor{}}
+			// hosts are in separate batches to make sure hosts reached later still get all of stdin
+			o := New(c, []string{"all"}, "_test-groups-file", NewOptions(0, Batch{size: 1}, 0, -1,
+				reporter, "", false, nil, strings.NewReader("config file\n"), nil))
+			numHostErrors, err := o.Do(context.Background(), action)
+			assert.NoError(t, err)
+			assert.Equal(t, 0, numHostErrors)
+			// every command gets all of stdin, but the hostname command doesn't get any
+			assert.Len(t, c.ActorsReturned, 3)
+			for _, a := range c.ActorsReturned {
+				assert.Equal(t, []string{"config file\n", "config file\n"}, a.Stdins)
+				assert.ElementsMatch(t, []string{"hostname", "first", "second"}, a.Commands)
+			}
+		})
+	}
+}
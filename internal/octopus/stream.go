@@ -0,0 +1,145 @@
+package octopus
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/BlaineEXE/octopus/internal/remote"
+)
+
+// Streamed output from all hosts is written while holding this lock so that lines of output from
+// different hosts are never interleaved.
+var outputLock sync.Mutex
+
+// very long lines without a newline are written in pieces so they aren't held in memory forever
+const maxPrefixWriterLine = 64 * 1024
+
+// A prefixWriter writes each complete line written to it to its output with a prefix. Partial lines
+// are held until they are completed or until the writer is flushed.
+type prefixWriter struct {
+	prefix []byte
+	out    io.Writer
+	buf    []byte
+}
+
+func newPrefixWriter(prefix string, out io.Writer) *prefixWriter {
+	return &prefixWriter{
+		prefix: []byte(prefix),
+		out:    out,
+		buf:    []byte{},
+	}
+}
+
+// Write always reports that all of p was written, since incomplete lines are buffered.
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	i := bytes.LastIndexByte(w.buf, '\n')
+	if i < 0 {
+		if len(w.buf) < maxPrefixWriterLine {
+			return len(p), nil
+		}
+		w.buf = append(w.buf, '\n')
+		i = len(w.buf) - 1
+	}
+
+	// write all complete lines at once
+	out := []byte{}
+	for _, line := range bytes.SplitAfter(w.buf[:i+1], []byte("\n")) {
+		if len(line) > 0 {
+			out = append(out, w.prefix...)
+			out = append(out, line...)
+		}
+	}
+	w.buf = append(w.buf[:0], w.buf[i+1:]...)
+
+	outputLock.Lock()
+	defer outputLock.Unlock()
+	_, err := w.out.Write(out)
+	return len(p), err
+}
+
+// Flush writes any final partial line with a newline added.
+func (w *prefixWriter) Flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	_, err := w.Write([]byte("\n"))
+	return err
+}
+
+// A streamReporter reports results whose output was already streamed as it was received by a
+// streamingActor, so it prints only the hostname-prefixed skip reason or error of each result.
+type streamReporter struct {
+	stdout io.Writer
+	stderr io.Writer
+}
+
+func (s *streamReporter) Begin(hosts []string) error { return nil }
+
+func (s *streamReporter) HostResult(r *Result) error {
+	outputLock.Lock()
+	defer outputLock.Unlock()
+	if r.Skipped {
+		if _, err := fmt.Fprintf(s.stderr, "%s: Skipped: %s\n", r.name(), r.SkipReason); err != nil {
+			return err
+		}
+	}
+	if r.Err != nil {
+		if _, err := fmt.Fprintf(s.stderr, "%s: %s: %+v\n", r.name(), errLabel(r), r.Err); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *streamReporter) End() error { return nil }
+
+// write the output of a result which wasn't streamed by a streamingActor as it was received
+func (s *streamReporter) writeOutput(r *Result) {
+	write := func(b *bytes.Buffer, out io.Writer) {
+		if b == nil {
+			return
+		}
+		w := newPrefixWriter(r.name()+": ", out)
+		w.Write(b.Bytes())
+		w.Flush()
+	}
+	write(r.Stdout, s.stdout)
+	write(r.Stderr, s.stderr)
+}
+
+// A streamingActor runs commands with their output written as soon as it is received, with each
+// line prefixed by the host's name. The output is also returned as normal. Other actor tasks are
+// done by the wrapped actor.
+type streamingActor struct {
+	remote.Actor
+	prefix string
+	stdout io.Writer
+	stderr io.Writer
+}
+
+func newStreamingActor(a remote.Actor, hostname string, s *streamReporter) *streamingActor {
+	return &streamingActor{
+		Actor:  a,
+		prefix: hostname + ": ",
+		stdout: s.stdout,
+		stderr: s.stderr,
+	}
+}
+
+func (a *streamingActor) RunCommand(command string) (stdout, stderr *bytes.Buffer, err error) {
+	stdout = new(bytes.Buffer)
+	stderr = new(bytes.Buffer)
+	outWriter := newPrefixWriter(a.prefix, a.stdout)
+	errWriter := newPrefixWriter(a.prefix, a.stderr)
+	err = a.Actor.StreamCommand(&remote.Command{
+		Command: command,
+		Stdout:  io.MultiWriter(stdout, outWriter),
+		Stderr:  io.MultiWriter(stderr, errWriter),
+	})
+	outWriter.Flush()
+	errWriter.Flush()
+	return
+}
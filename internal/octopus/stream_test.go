@@ -0,0 +1,97 @@
+package octopus
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/BlaineEXE/octopus/internal/remote"
+	remotetest "github.com/BlaineEXE/octopus/internal/remote/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_prefixWriter(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []string
+		want   string
+	}{
+		{"one line", []string{"hello\n"}, "host: hello\n"},
+		{"several lines in one write", []string{"a\nb\nc\n"}, "host: a\nhost: b\nhost: c\n"},
+		{"line split across writes", []string{"hel", "lo\nwor", "ld\n"}, "host: hello\nhost: world\n"},
+		{"partial last line is flushed", []string{"a\nb"}, "host: a\nhost: b\n"},
+		{"empty lines", []string{"\n\n"}, "host: \nhost: \n"},
+		{"nothing", []string{}, ""},
+		{"very long line", []string{strings.Repeat("x", maxPrefixWriterLine)},
+			"host: " + strings.Repeat("x", maxPrefixWriterLine) + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := new(bytes.Buffer)
+			w := newPrefixWriter("host: ", out)
+			for _, s := range tt.writes {
+				n, err := w.Write([]byte(s))
+				assert.NoError(t, err)
+				assert.Equal(t, len(s), n)
+			}
+			assert.NoError(t, w.Flush())
+			assert.Equal(t, tt.want, out.String())
+		})
+	}
+}
+
+func Test_prefixWriter_noInterleaving(t *testing.T) {
+	out := new(bytes.Buffer)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			w := newPrefixWriter(fmt.Sprintf("host%d: ", i), out)
+			for j := 0; j < 100; j++ {
+				// write each line in pieces to give other hosts chances to write mid-line
+				w.Write([]byte(fmt.Sprintf("line %d ", j)))
+				w.Write([]byte(fmt.Sprintf("of host%d\n", i)))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	assert.Len(t, lines, 1000)
+	for _, l := range lines {
+		var host, j, lineHost int
+		_, err := fmt.Sscanf(l, "host%d: line %d of host%d", &host, &j, &lineHost)
+		assert.NoError(t, err, l)
+		assert.Equal(t, host, lineHost, l)
+	}
+}
+
+func TestOctopus_Do_stream(t *testing.T) {
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	reporter, err := NewReporter(StreamFormat, stdout, stderr)
+	assert.NoError(t, err)
+
+	getAddrsFromGroupsFile = func(hostGroups []string, groupsFile string) ([][]string, error) {
+		return [][]string{{"1.1.1.1", "2.2.2.2"}}, nil
+	}
+
+	c := &remotetest.MockRemoteConnector{
+		ReturnActor:        &remotetest.MockRemoteActor{},
+		ErrorOnConnectHost: "2.2.2.2",
+	}
+	o := New(c, []string{"all"}, "_test-groups-file", NewOptions(0, Batch{}, 0, -1, reporter, "", false, nil, nil, nil))
+	var action remote.Action = func(a remote.Actor, h *remote.HostInfo) (o, e *bytes.Buffer, err error) {
+		return a.RunCommand("cmd")
+	}
+	numHostErrors, err := o.Do(context.Background(), action)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, numHostErrors)
+	assert.Equal(t, "1.1.1.1-hostname: cmd: stdout ok\n", stdout.String())
+	// hosts finish in any order
+	assert.ElementsMatch(t, []string{"1.1.1.1-hostname: cmd: stderr ok", "2.2.2.2: Error: 2.2.2.2 fail"},
+		strings.Split(strings.TrimSuffix(stderr.String(), "\n"), "\n"))
+}
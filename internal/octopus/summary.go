@@ -0,0 +1,139 @@
+package octopus
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/BlaineEXE/octopus/internal/remote"
+)
+
+// Allow this to be overridden for tests.
+var summaryOutput io.Writer = os.Stderr
+
+// Kinds of host failures. Unreachable hosts are reported in the summary separately from the hosts
+// which failed, and the other kinds are reported in the order given by failureKinds.
+const (
+	interruptedFailure = "interrupted"
+	unreachableFailure = "unreachable"
+	connectFailure     = "connect"
+	authFailure        = "auth"
+	timeoutFailure     = "timeout"
+	exitFailure        = "non-zero exit"
+	otherFailure       = "other"
+)
+
+var failureKinds = []string{
+	interruptedFailure, connectFailure, authFailure, timeoutFailure, exitFailure, otherFailure}
+
+// determine the kind of failure a result is, or "" if the result is not a failure
+func failureKind(r *Result) string {
+	if r.Skipped || r.Err == nil {
+		return ""
+	}
+	if r.Interrupted {
+		return interruptedFailure
+	}
+	switch e := r.Err.(type) {
+	case *remote.UnreachableError:
+		return unreachableFailure
+	case *remote.AuthError:
+		return authFailure
+	case *remote.TimeoutError:
+		return timeoutFailure
+	case *remote.ExitError:
+		return exitFailure
+	default:
+		// the host was reached, but connecting to it failed
+		if !r.Connected && !r.Local {
+			return connectFailure
+		}
+		if te, ok := e.(interface{ Timeout() bool }); ok && te.Timeout() {
+			return timeoutFailure
+		}
+		return otherFailure
+	}
+}
+
+// A summary is an overview of the results from all hosts.
+type summary struct {
+	succeeded   []string
+	failed      map[string][]string // failure kind -> hosts
+	numFailed   int
+	unreachable []string
+	skipped     []string
+	total       time.Duration // time taken for all hosts
+
+	// the fastest and slowest hosts which were operated on
+	fastest, slowest         string
+	fastestTime, slowestTime time.Duration
+}
+
+func newSummary(results []Result, total time.Duration) *summary {
+	s := &summary{
+		succeeded:   []string{},
+		failed:      map[string][]string{},
+		unreachable: []string{},
+		skipped:     []string{},
+		total:       total,
+	}
+	for i := range results {
+		r := &results[i]
+		if r.Skipped {
+			s.skipped = append(s.skipped, r.id())
+			continue
+		}
+		switch k := failureKind(r); k {
+		case "":
+			s.succeeded = append(s.succeeded, r.id())
+		case unreachableFailure:
+			s.unreachable = append(s.unreachable, r.id())
+		default:
+			s.failed[k] = append(s.failed[k], r.id())
+			s.numFailed++
+		}
+		d := r.End.Sub(r.Start)
+		if s.fastest == "" || d < s.fastestTime {
+			s.fastest, s.fastestTime = r.id(), d
+		}
+		if s.slowest == "" || d > s.slowestTime {
+			s.slowest, s.slowestTime = r.id(), d
+		}
+	}
+	return s
+}
+
+func (s *summary) print(w io.Writer) {
+	hosts := func(h []string) string {
+		return fmt.Sprintf("(%d): %s", len(h), compressHostList(h))
+	}
+	lines := []string{
+		"~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~",
+		" Summary",
+		"~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~",
+		"",
+		"succeeded " + hosts(s.succeeded),
+		fmt.Sprintf("failed (%d)", s.numFailed),
+	}
+	for _, k := range failureKinds {
+		if h, ok := s.failed[k]; ok {
+			lines = append(lines, "  "+k+" "+hosts(h))
+		}
+	}
+	if len(s.unreachable) > 0 {
+		lines = append(lines, "unreachable "+hosts(s.unreachable))
+	}
+	if len(s.skipped) > 0 {
+		lines = append(lines, "skipped (not reached) "+hosts(s.skipped))
+	}
+	lines = append(lines, "", "total time: "+s.total.Round(time.Millisecond).String())
+	if s.fastest != "" {
+		lines = append(lines,
+			fmt.Sprintf("fastest host: %s (%s)", s.fastest, s.fastestTime.Round(time.Millisecond)),
+			fmt.Sprintf("slowest host: %s (%s)", s.slowest, s.slowestTime.Round(time.Millisecond)),
+		)
+	}
+	fmt.Fprintf(w, "%s\n\n", strings.Join(lines, "\n"))
+}
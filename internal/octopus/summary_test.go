@@ -0,0 +1,105 @@
+package octopus
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/BlaineEXE/octopus/internal/remote"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_failureKind(t *testing.T) {
+	tests := []struct {
+		name   string
+		result Result
+		want   string
+	}{
+		{"success", Result{Connected: true}, ""},
+		{"skipped", Result{Skipped: true, Err: fmt.Errorf("skipped")}, ""},
+		{"unreachable", Result{Err: &remote.UnreachableError{Err: fmt.Errorf("connection refused")}},
+			unreachableFailure},
+		{"unreachable timeout", Result{Err: &remote.UnreachableError{
+			Err: &remote.TimeoutError{Operation: "connecting"}}}, unreachableFailure},
+		{"connect", Result{Err: fmt.Errorf("ssh: handshake failed")}, connectFailure},
+		{"auth", Result{Err: &remote.AuthError{Err: fmt.Errorf("no keys")}}, authFailure},
+		{"handshake timeout", Result{Err: &remote.TimeoutError{Operation: "ssh handshake"}}, timeoutFailure},
+		{"command timeout",
+			Result{Connected: true, Err: &remote.TimeoutError{Operation: "command"}}, timeoutFailure},
+		{"non-zero exit",
+			Result{Connected: true, Err: &remote.ExitError{Status: remote.ExitStatus{Code: 2}}}, exitFailure},
+		{"other", Result{Connected: true, Err: fmt.Errorf("sftp failure")}, otherFailure},
+		{"without connecting", Result{Local: true, Err: fmt.Errorf("failed to render command template")},
+			otherFailure},
+		{"interrupted",
+			Result{Connected: true, Err: fmt.Errorf("failed to copy 1 path(s)"), Interrupted: true},
+			interruptedFailure},
+		{"interrupted connect",
+			Result{Err: &remote.InterruptedError{Operation: "connecting"}, Interrupted: true},
+			interruptedFailure},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, failureKind(&tt.result))
+		})
+	}
+}
+
+func Test_newSummary(t *testing.T) {
+	start := time.Now()
+	res := func(host, hostname string, d time.Duration, connected bool, err error) Result {
+		return Result{Host: host, Hostname: hostname, Start: start, End: start.Add(d),
+			Connected: connected, Err: err}
+	}
+	results := []Result{
+		res("10.0.0.1", "node1", 2*time.Second, true, nil),
+		res("10.0.0.2", "node2", 1*time.Second, true, nil),
+		res("10.0.0.3", "", 5*time.Second, false,
+			&remote.UnreachableError{Err: fmt.Errorf("connection refused")}),
+		res("10.0.0.4", "node4", 3*time.Second, true,
+			&remote.ExitError{Status: remote.ExitStatus{Code: 1}}),
+		{Host: "10.0.0.5", Skipped: true, SkipReason: "too many failures"},
+		res("10.0.0.6", "", 2*time.Second, false, &remote.AuthError{Err: fmt.Errorf("no keys")}),
+		res("10.0.0.7", "", 2*time.Second, false, fmt.Errorf("ssh: handshake failed")),
+	}
+
+	s := newSummary(results, 7*time.Second)
+	assert.Equal(t, []string{"node1", "node2"}, s.succeeded)
+	assert.Equal(t, map[string][]string{
+		connectFailure: {"10.0.0.7"},
+		authFailure:    {"10.0.0.6"},
+		exitFailure:    {"node4"},
+	}, s.failed)
+	assert.Equal(t, 3, s.numFailed)
+	assert.Equal(t, []string{"10.0.0.3"}, s.unreachable)
+	assert.Equal(t, []string{"10.0.0.5"}, s.skipped)
+	assert.Equal(t, "node2", s.fastest)
+	assert.Equal(t, 1*time.Second, s.fastestTime)
+	assert.Equal(t, "10.0.0.3", s.slowest)
+	assert.Equal(t, 5*time.Second, s.slowestTime)
+
+	b := &bytes.Buffer{}
+	s.print(b)
+	out := b.String()
+	assert.Contains(t, out, "succeeded (2): node[1-2]\n")
+	assert.Contains(t, out, "failed (3)\n")
+	assert.Contains(t, out, "  connect (1): 10.0.0.7\n")
+	assert.Contains(t, out, "  auth (1): 10.0.0.6\n")
+	assert.Contains(t, out, "  non-zero exit (1): node4\n")
+	assert.NotContains(t, out, "timeout")
+	assert.Contains(t, out, "unreachable (1): 10.0.0.3\n")
+	assert.Contains(t, out, "skipped (not reached) (1): 10.0.0.5\n")
+	assert.Contains(t, out, "total time: 7s\n")
+	assert.Contains(t, out, "fastest host: node2 (1s)\n")
+	assert.Contains(t, out, "slowest host: 10.0.0.3 (5s)\n")
+}
+
+func Test_newSummary_noHosts(t *testing.T) {
+	b := &bytes.Buffer{}
+	newSummary([]Result{}, 0).print(b)
+	assert.Contains(t, b.String(), "succeeded (0): \n")
+	assert.Contains(t, b.String(), "failed (0)\n")
+	assert.NotContains(t, b.String(), "unreachable")
+	assert.NotContains(t, b.String(), "fastest")
+}
@@ -0,0 +1,81 @@
+package remote
+
+import (
+	"fmt"
+	"time"
+)
+
+// A TimeoutError is reported when a remote operation does not finish within its time limit.
+type TimeoutError struct {
+	Operation string // e.g., "connecting to host 10.0.0.5"
+	Limit     time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s timed out after %s", e.Operation, e.Limit)
+}
+
+// Timeout returns true. This allows callers to check for timeouts the same way as for net.Error.
+func (e *TimeoutError) Timeout() bool {
+	return true
+}
+
+// ExitStatus describes how a remote command exited.
+type ExitStatus struct {
+	Code   int    // the command's exit code, or -1 if the command was killed by a signal
+	Signal string // the name of the signal which killed the command (e.g., "KILL"), if any
+}
+
+// An ExitError is reported when a remote command runs to completion but exits with a non-zero
+// status or is killed by a signal. Errors which are not ExitErrors mean the command did not run or
+// did not finish (e.g., the connection failed or the command timed out).
+type ExitError struct {
+	Status  ExitStatus
+	Message string // an optional message from the remote host about the exit
+}
+
+func (e *ExitError) Error() string {
+	s := fmt.Sprintf("command exited with status %d", e.Status.Code)
+	if e.Status.Signal != "" {
+		s = fmt.Sprintf("command was killed by signal %s", e.Status.Signal)
+	}
+	if e.Message != "" {
+		s += ": " + e.Message
+	}
+	return s
+}
+
+// An AuthError is reported when a host rejects all of the methods with which a connector tried to
+// authenticate.
+type AuthError struct {
+	Err error
+}
+
+func (e *AuthError) Error() string {
+	return fmt.Sprintf("authentication failed: %+v", e.Err)
+}
+
+// An UnreachableError is reported when a host can't be reached at all (e.g., connecting to it is
+// refused or times out), as opposed to failing once it has been reached.
+type UnreachableError struct {
+	Err error
+}
+
+func (e *UnreachableError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the error which made the host unreachable.
+func (e *UnreachableError) Unwrap() error {
+	return e.Err
+}
+
+// An InterruptedError is reported when a remote operation is stopped because the context it was
+// run with was canceled (e.g., because the user interrupted octopus).
+type InterruptedError struct {
+	Operation string // e.g., "command"
+}
+
+func (e *InterruptedError) Error() string {
+	return fmt.Sprintf("%s was interrupted", e.Operation)
+}
@@ -0,0 +1,37 @@
+package remote
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExitError_Error(t *testing.T) {
+	tests := []struct {
+		err  *ExitError
+		want string
+	}{
+		{&ExitError{Status: ExitStatus{Code: 1}}, "command exited with status 1"},
+		{&ExitError{Status: ExitStatus{Code: -1, Signal: "KILL"}}, "command was killed by signal KILL"},
+		{&ExitError{Status: ExitStatus{Code: 127}, Message: "not found"}, "command exited with status 127: not found"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tt.err.Error())
+	}
+}
+
+func TestUnreachableError(t *testing.T) {
+	inner := &TimeoutError{Operation: "connecting to 10.0.0.5:22", Limit: 30 * time.Second}
+	var err error = &UnreachableError{Err: inner}
+	assert.Equal(t, "connecting to 10.0.0.5:22 timed out after 30s", err.Error())
+	assert.Equal(t, inner, errors.Unwrap(err))
+}
+
+func TestTimeoutError(t *testing.T) {
+	var err error = &TimeoutError{Operation: "connecting to 10.0.0.5:22", Limit: 30 * time.Second}
+	assert.Equal(t, "connecting to 10.0.0.5:22 timed out after 30s", err.Error())
+	te, ok := err.(interface{ Timeout() bool })
+	assert.True(t, ok && te.Timeout())
+}
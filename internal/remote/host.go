@@ -0,0 +1,78 @@
+package remote
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// A Host is a remote host target to which a Connector can connect. User and Port are optional and
+// take precedence over users and ports configured by other means when they are set.
+type Host struct {
+	Address string // host name or IP address; IPv6 addresses are stored without square brackets
+	User    string // empty if not set
+	Port    uint16 // 0 if not set
+}
+
+// ParseHost parses a host target of the form [user@]address[:port]. An IPv6 address with a port must
+// be surrounded by square brackets (e.g., '[fe80::1]:2222'); an IPv6 address without a port may be
+// given with or without brackets (e.g., 'admin@fe80::1' or '[fe80::1]').
+func ParseHost(s string) (Host, error) {
+	h := Host{Address: s}
+	if i := strings.LastIndex(h.Address, "@"); i >= 0 {
+		h.User, h.Address = h.Address[:i], h.Address[i+1:]
+		if h.User == "" {
+			return Host{}, fmt.Errorf("invalid host %q. user is empty", s)
+		}
+	}
+
+	switch {
+	case strings.HasPrefix(h.Address, "[") && strings.HasSuffix(h.Address, "]"):
+		h.Address = h.Address[1 : len(h.Address)-1]
+	case strings.HasPrefix(h.Address, "[") || strings.Count(h.Address, ":") == 1:
+		addr, port, err := net.SplitHostPort(h.Address)
+		if err != nil {
+			return Host{}, fmt.Errorf("invalid host %q. %+v", s, err)
+		}
+		p, err := strconv.ParseUint(port, 10, 16)
+		if err != nil || p == 0 {
+			return Host{}, fmt.Errorf("invalid port %q in host %q", port, s)
+		}
+		h.Address, h.Port = addr, uint16(p)
+	}
+	// any other address with colons is a bare IPv6 address without a port
+
+	if h.Address == "" {
+		return Host{}, fmt.Errorf("invalid host %q. address is empty", s)
+	}
+	return h, nil
+}
+
+// String returns the host in the form [user@]address[:port], with IPv6 addresses in square
+// brackets when a port is given.
+func (h Host) String() string {
+	s := h.Address
+	if h.Port != 0 {
+		s = net.JoinHostPort(h.Address, strconv.Itoa(int(h.Port)))
+	}
+	if h.User != "" {
+		s = h.User + "@" + s
+	}
+	return s
+}
+
+// HostInfo is what is known about a host target from the host groups it is in. Actions may use it
+// to do something different on each host.
+type HostInfo struct {
+	Host   Host
+	Group  string            // the host group in which the host's entry is
+	Index  int               // the index of the host's entry within its group, starting from 0
+	Groups []string          // all of the host groups being operated on which have the host
+	Attrs  map[string]string // attributes given in the host's entry; never nil
+
+	// Hostname returns the host's hostname as reported by the host, or "" if it could not be
+	// gotten. It may wait for the hostname to be gotten, so call it only when it is needed. It is
+	// nil if the host is not connected to.
+	Hostname func() string
+}
@@ -0,0 +1,47 @@
+package remote
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseHost(t *testing.T) {
+	tests := []struct {
+		s          string
+		want       Host
+		wantString string
+		wantErr    bool
+	}{
+		{"10.0.0.5", Host{"10.0.0.5", "", 0}, "10.0.0.5", false},
+		{"node-1.local", Host{"node-1.local", "", 0}, "node-1.local", false},
+		{"admin@10.0.0.5:2222", Host{"10.0.0.5", "admin", 2222}, "admin@10.0.0.5:2222", false},
+		{"node-1:2222", Host{"node-1", "", 2222}, "node-1:2222", false},
+		{"admin@node-1", Host{"node-1", "admin", 0}, "admin@node-1", false},
+		{"[fe80::1]:22", Host{"fe80::1", "", 22}, "[fe80::1]:22", false},
+		{"admin@[fe80::1]:2222", Host{"fe80::1", "admin", 2222}, "admin@[fe80::1]:2222", false},
+		{"[fe80::1]", Host{"fe80::1", "", 0}, "fe80::1", false},
+		{"fe80::1", Host{"fe80::1", "", 0}, "fe80::1", false},
+		{"admin@2001:db8::5", Host{"2001:db8::5", "admin", 0}, "admin@2001:db8::5", false},
+		{"node-1:ssh", Host{}, "", true},
+		{"node-1:0", Host{}, "", true},
+		{"node-1:65536", Host{}, "", true},
+		{"[fe80::1", Host{}, "", true},
+		{"[fe80::1]2222", Host{}, "", true},
+		{"@node-1", Host{}, "", true},
+		{"admin@", Host{}, "", true},
+		{":22", Host{}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := ParseHost(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseHost() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Equal(t, tt.want, got)
+			if !tt.wantErr {
+				assert.Equal(t, tt.wantString, got.String())
+			}
+		})
+	}
+}
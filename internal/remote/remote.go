@@ -2,7 +2,10 @@ package remote
 
 import (
 	"bytes"
+	"context"
+	"io"
 	"os"
+	"time"
 )
 
 // A Connector can configure how remote connections are to be made and make remote connections to
@@ -13,16 +16,58 @@ type Connector interface {
 	// connector will try when connecting to remote hosts.
 	AddIdentityFile(filePath string) error
 
-	// Port should set the port on which remote connections will be made to hosts.
+	// UseAgent should add the keys held by the user's ssh-agent to the remote authentication methods
+	// the connector will try when connecting to remote hosts.
+	UseAgent() error
+
+	// Port should set the port on which remote connections will be made to hosts. The port set here
+	// should take precedence over ports configured for individual hosts by other means.
 	Port(p uint16) error
 
-	// User should set the user on hosts to which connections will be made.
+	// User should set the user on hosts to which connections will be made. The user set here should
+	// take precedence over users configured for individual hosts by other means.
 	User(u string) error
 
+	// SSHConfigFile should set the OpenSSH client config file from which per-host connection
+	// settings are read. If the path is empty, no config file should be read.
+	SSHConfigFile(filePath string) error
+
+	// JumpHosts should set the jump hosts (bastions) through which connections to hosts are
+	// tunneled, in order. The jump hosts set here should take precedence over jump hosts configured
+	// for individual hosts by other means. An empty list should leave per-host jump hosts in use.
+	JumpHosts(hosts []string) error
+
+	// ConnectTimeout should set the time limit for connecting to each host, including the protocol
+	// handshake and authentication. Hosts which time out should be reported with a TimeoutError,
+	// but hosts which can't be reached at all before the limit (e.g., because they are down)
+	// should be reported with an UnreachableError. The time limit set here should take precedence
+	// over limits configured by other means.
+	ConnectTimeout(t time.Duration) error
+
+	// CommandTimeout should set the time limit for each command run on hosts. A command which
+	// times out should be killed and reported with a TimeoutError. A zero limit means no limit.
+	CommandTimeout(t time.Duration) error
+
+	// Env should set environment variables for every command run on hosts. Variables should be
+	// set without changing the commands themselves when the host allows it.
+	Env(env map[string]string) error
+
+	// RequestTTY should set whether commands run on hosts are given a pseudo-terminal. Output from
+	// commands with a pseudo-terminal should have plain newlines like output from other commands.
+	RequestTTY(request bool) error
+
+	// HostKeyChecking should set how remote host keys are verified when connecting to hosts. Hosts
+	// which fail verification should be reported as connection errors.
+	HostKeyChecking(mode string, knownHostsFiles []string) error
+
 	// Connect should connect to the host with the options that have been previously set and return
-	// an actor which can be called to perform tasks on the remote host. If an error is reported,
-	// the actor should not need to have its Close method called.
-	Connect(host string) (Actor, error)
+	// an actor which can be called to perform tasks on the remote host. The host's user and port,
+	// if set, should take precedence over all others. If the host rejects authentication, the error
+	// should be an *AuthError. If an error is reported, the actor should not need to have its Close
+	// method called. Once the context is canceled, connecting should stop, and the actor's commands
+	// should be stopped and reported with an InterruptedError; the actor should not start new tasks
+	// other than cleanup commands.
+	Connect(ctx context.Context, host Host) (Actor, error)
 }
 
 // An Actor can perform a task on a remote host.
@@ -30,8 +75,16 @@ type Connector interface {
 // Multiple Actor tasks will be run simultaneously on each remote host connection.
 type Actor interface {
 	// RunCommand should run the command on the remote host specified in the Connector.Connect method.
+	// If the command runs but exits with a non-zero status, the error should be an *ExitError.
 	RunCommand(command string) (stdout, stderr *bytes.Buffer, err error)
 
+	// StreamCommand should run the command on the remote host specified in the Connector.Connect
+	// method, writing the command's stdout and stderr to the command's writers as soon as the
+	// output is received and sending the command's stdin, if any, to the remote command. Returning
+	// should not wait for all of stdin to be sent. Errors should be reported the same as for
+	// RunCommand.
+	StreamCommand(c *Command) error
+
 	// CreateRemotedir should create a directory along with any nonexistent parents on the remote
 	// host specified in the Connector.Connect method. Should return nil if the paths already exist.
 	CreateRemoteDir(dirPath string, perms os.FileMode) error
@@ -44,5 +97,19 @@ type Actor interface {
 	Close() error
 }
 
-// An Action function is a function that tells an actor how to do a task.
-type Action func(a Actor) (stdout, stderr *bytes.Buffer, err error)
+// A Command is a command to be run on a remote host with streaming input and output.
+type Command struct {
+	Command string
+	Stdout  io.Writer // may not be nil
+	Stderr  io.Writer // may not be nil
+	Stdin   io.Reader // may be nil; the command's stdin is closed once this returns EOF
+
+	// Cleanup commands (e.g., removing temporary files) should still be run after the actor's
+	// context is canceled, but they should be given only a short time to finish.
+	Cleanup bool
+}
+
+// An Action function is a function that tells an actor how to do a task on the host described by
+// the host info. If the action runs a command which exits with a non-zero status, the error should
+// be an *ExitError.
+type Action func(a Actor, h *HostInfo) (stdout, stderr *bytes.Buffer, err error)
@@ -2,10 +2,14 @@ package test
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"strings"
 	"sync"
+
+	"github.com/BlaineEXE/octopus/internal/remote"
 )
 
 // MockRemoteActor is a reusable mock remote.Actor to be used for testing.
@@ -16,9 +20,11 @@ type MockRemoteActor struct {
 	CommandError     bool   // issue error on command?
 	CreateDirErrorOn string // issue error when dir contains this string ("" is no error)
 	CopyFileErrorOn  string // issue error when file contains this string ("" is no error)
+	WaitOn           string // wait for interruption when command contains this string ("" is never)
 
 	// Results
 	Commands       []string // all commands actor has attempted to run
+	Stdins         []string // stdin of all streamed commands which had stdin
 	DirCreates     []string // all dirs actor has attempted to create (incl. failed ones)
 	DirCreateModes []os.FileMode
 	DirCreateFails []string // dirs actor has failed to create
@@ -26,6 +32,8 @@ type MockRemoteActor struct {
 	FileCopyModes  []os.FileMode
 	FileCopyFails  []string // files actor has failed to copy
 	CloseCalled    int      // Close has been called this many times
+
+	ctx context.Context // the context given to the connector
 }
 
 // shortcut for bytes.NewBufferString
@@ -38,9 +46,28 @@ var actorMutex = sync.Mutex{}
 // It will return Hostname if the command is "hostname", or an error if HostnameError is true.
 // It will always return data on stdout and stderr in the form below where command is the command
 // intput, stdout/stderr is the buffer on which the data is returned, and ok unless CommandError is
-// true, in which case err:
+// true, in which case err (and the error is a *remote.ExitError with exit code 1):
 //   <command>: <stdout|stderr> <ok|err>
+// If the command contains WaitOn, it returns no output and a *remote.InterruptedError once the
+// context given to the connector is canceled. Once the context is canceled, commands are not run
+// (or added to Commands) and return a *remote.InterruptedError.
 func (m *MockRemoteActor) RunCommand(command string) (stdout, stderr *bytes.Buffer, err error) {
+	return m.run(command, false)
+}
+
+// cleanup commands are run even once the context is canceled
+func (m *MockRemoteActor) run(command string, cleanup bool) (stdout, stderr *bytes.Buffer, err error) {
+	if !cleanup && m.ctx != nil && m.ctx.Err() != nil {
+		return bs(""), bs(""), &remote.InterruptedError{Operation: "command"}
+	}
+	if m.WaitOn != "" && strings.Contains(command, m.WaitOn) {
+		actorMutex.Lock()
+		app(&m.Commands, command)
+		actorMutex.Unlock()
+		<-m.ctx.Done()
+		return bs(""), bs(""), &remote.InterruptedError{Operation: "command"}
+	}
+
 	actorMutex.Lock()
 	defer actorMutex.Unlock()
 	app(&m.Commands, command)
@@ -52,12 +79,30 @@ func (m *MockRemoteActor) RunCommand(command string) (stdout, stderr *bytes.Buff
 		return bs(m.Hostname), bs(""), nil
 	}
 	if m.CommandError {
-		return bs(command + ": stdout err"), bs(command + ": stderr err"),
-			fmt.Errorf("test command error running command %s", command)
+		return bs(command + ": stdout err"), bs(command + ": stderr err"), &remote.ExitError{
+			Status:  remote.ExitStatus{Code: 1},
+			Message: fmt.Sprintf("test command error running command %s", command),
+		}
 	}
 	return bs(command + ": stdout ok"), bs(command + ": stderr ok"), nil
 }
 
+// StreamCommand is a mock function that behaves the same as RunCommand but writes the command's
+// output to the command's writers. If the command has stdin, all of it is read and appended to
+// Stdins before the command is run. Cleanup commands are run even once the context is canceled.
+func (m *MockRemoteActor) StreamCommand(c *remote.Command) error {
+	if c.Stdin != nil {
+		in, _ := ioutil.ReadAll(c.Stdin)
+		actorMutex.Lock()
+		app(&m.Stdins, string(in))
+		actorMutex.Unlock()
+	}
+	stdout, stderr, err := m.run(c.Command, c.Cleanup)
+	c.Stdout.Write(stdout.Bytes())
+	c.Stderr.Write(stderr.Bytes())
+	return err
+}
+
 // ExpectedCommandOutput returns string versions of stdout and stderr expected for the command
 // and the command's expected error state.
 func ExpectedCommandOutput(command string, err bool) (stdout, stderr string) {
@@ -1,9 +1,11 @@
 package test
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/BlaineEXE/octopus/internal/remote"
 )
@@ -34,11 +36,16 @@ func (c *MockRemoteConnector) AddIdentityFile(filePath string) error {
 	app(&c.IdentityFileAdds, filePath)
 	if c.ErrorOnIdentityFile != "" && strings.Contains(filePath, c.ErrorOnIdentityFile) {
 		app(&c.IdentityFileAddFails, filePath)
-		return fmt.Errorf(filePath + " fail")
+		return fmt.Errorf("%s fail", filePath)
 	}
 	return nil
 }
 
+// UseAgent is a mock method that is not yet implemented.
+func (c *MockRemoteConnector) UseAgent() error {
+	panic("not implemented")
+}
+
 // Port is a mock method that is not yet implemented.
 func (c *MockRemoteConnector) Port(p uint16) error {
 	panic("not implemented")
@@ -49,20 +56,57 @@ func (c *MockRemoteConnector) User(u string) error {
 	panic("not implemented")
 }
 
-// Connect is a mock method that appends each host to HostConnects.
-// It returns a copy of ReturnActor with Hostname="host-hostname"
+// SSHConfigFile is a mock method that is not yet implemented.
+func (c *MockRemoteConnector) SSHConfigFile(filePath string) error {
+	panic("not implemented")
+}
+
+// JumpHosts is a mock method that is not yet implemented.
+func (c *MockRemoteConnector) JumpHosts(hosts []string) error {
+	panic("not implemented")
+}
+
+// ConnectTimeout is a mock method that is not yet implemented.
+func (c *MockRemoteConnector) ConnectTimeout(t time.Duration) error {
+	panic("not implemented")
+}
+
+// CommandTimeout is a mock method that is not yet implemented.
+func (c *MockRemoteConnector) CommandTimeout(t time.Duration) error {
+	panic("not implemented")
+}
+
+// Env is a mock method that is not yet implemented.
+func (c *MockRemoteConnector) Env(env map[string]string) error {
+	panic("not implemented")
+}
+
+// RequestTTY is a mock method that is not yet implemented.
+func (c *MockRemoteConnector) RequestTTY(request bool) error {
+	panic("not implemented")
+}
+
+// HostKeyChecking is a mock method that is not yet implemented.
+func (c *MockRemoteConnector) HostKeyChecking(mode string, knownHostsFiles []string) error {
+	panic("not implemented")
+}
+
+// Connect is a mock method that appends each host (as a string) to HostConnects.
+// It returns a copy of ReturnActor with Hostname="host-hostname" which is interrupted by the context.
 // If host contains ErrorOnHostConnect, an error will be returned, and host appended to HostConnectFails.
-func (c *MockRemoteConnector) Connect(host string) (remote.Actor, error) {
+func (c *MockRemoteConnector) Connect(ctx context.Context, h remote.Host) (remote.Actor, error) {
+	host := h.String()
 	connectorMutex.Lock()
 	defer connectorMutex.Unlock()
 	app(&c.HostConnects, host)
 	if c.ErrorOnConnectHost != "" && strings.Contains(host, c.ErrorOnConnectHost) {
 		app(&c.HostConnectFails, host)
-		return nil, fmt.Errorf(host + " fail")
+		return nil, fmt.Errorf("%s fail", host)
 	}
 	r := &MockRemoteActor{}
 	*r = *c.ReturnActor
 	r.Hostname = host + "-hostname"
+	r.ctx = ctx
 	//fmt.Println("r hostname:", r.Hostname)
 	c.ActorsReturned = append(c.ActorsReturned, r)
 	return r, nil
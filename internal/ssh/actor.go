@@ -1,9 +1,11 @@
 package ssh
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"sync"
+	"time"
 
 	"github.com/BlaineEXE/octopus/internal/logger"
 	"github.com/pkg/sftp"
@@ -25,6 +27,7 @@ var UserSFTPOptions = SFTPOptions{
 func newActor(host string, s *ssh.Client) *Actor {
 	return &Actor{
 		host:            host,
+		ctx:             context.Background(),
 		sshClient:       s,
 		sftpOptions:     UserSFTPOptions,
 		_sftpCreateOnce: sync.Once{},
@@ -34,9 +37,13 @@ func newActor(host string, s *ssh.Client) *Actor {
 
 // An Actor is able to perform actions on a remote via an SSH connection established to the host.
 type Actor struct {
-	host        string
-	sshClient   *ssh.Client
-	sftpOptions SFTPOptions
+	host           string
+	ctx            context.Context // commands are interrupted once this is canceled
+	sshClient      *ssh.Client
+	sftpOptions    SFTPOptions
+	commandTimeout time.Duration // zero means no limit
+	env            map[string]string
+	tty            bool // request a pseudo-terminal for commands
 
 	// SFTP client creation is done lazily if files are to be copied, and only once for each actor
 	_sftpClient     *sftp.Client
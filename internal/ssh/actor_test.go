@@ -19,7 +19,7 @@ type stubCloser struct {
 func (s *stubCloser) Close() error {
 	s.closeCalled++
 	if s.returnErr != "" {
-		return fmt.Errorf(s.returnErr)
+		return fmt.Errorf("%s", s.returnErr)
 	}
 	return nil
 }
@@ -0,0 +1,116 @@
+package ssh
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+
+	"github.com/BlaineEXE/octopus/internal/logger"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// AddIdentityFile adds the identity file's key to the remote authentication methods ssh will try
+// when connecting to remote hosts. If the key is encrypted, the passphrase is asked for once, and
+// the decrypted key is used for all connections.
+func (c *Connector) AddIdentityFile(filePath string) error {
+	logger.Info.Println("adding identity file:", filePath)
+
+	signer, err := loadIdentityFile(filePath)
+	if err != nil {
+		return err
+	}
+
+	c.signers = append(c.signers, signer)
+	c.signerFiles[filePath] = true
+	return nil
+}
+
+func loadIdentityFile(filePath string) (ssh.Signer, error) {
+	key, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := parsePrivateKey(filePath, key)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse private key from file %s. %+v", filePath, err)
+	}
+	return signer, nil
+}
+
+// hostSigners returns signers for identity files which are configured for individual hosts (e.g.,
+// in the ssh config file). Keys are only read once, and keys which have already been added for all
+// hosts are not returned again. Files which don't exist or can't be read are skipped. This may ask
+// the user for a passphrase, so it is called before connecting to the host rather than during the
+// ssh handshake, where waiting for the user would count toward the connect timeout.
+func (c *Connector) hostSigners(filePaths []string) []ssh.Signer {
+	c.hostSignersLock.Lock() // also makes sure the user is only asked for a passphrase once
+	defer c.hostSignersLock.Unlock()
+
+	signers := []ssh.Signer{}
+	for _, f := range filePaths {
+		if c.signerFiles[f] {
+			continue
+		}
+		s, ok := c.hostSignerCache[f]
+		if !ok {
+			var err error
+			s, err = loadIdentityFile(f)
+			if os.IsNotExist(err) {
+				logger.Info.Println("skipping host identity file which does not exist:", f)
+			} else if err != nil {
+				logger.Warning.Printf("skipping host identity file %s. %+v", f, err)
+			}
+			c.hostSignerCache[f] = s // nil on failure so the file isn't tried again
+		}
+		if s != nil {
+			signers = append(signers, s)
+		}
+	}
+	return signers
+}
+
+var dialAgent = func(socket string) (net.Conn, error) {
+	return net.Dial("unix", socket)
+}
+
+// UseAgent adds the keys held by the ssh-agent listening on the socket given by the SSH_AUTH_SOCK
+// environment variable to the remote authentication methods ssh will try when connecting to remote
+// hosts. Agent keys are tried after keys from identity files.
+func (c *Connector) UseAgent() error {
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return fmt.Errorf("unable to use ssh-agent. SSH_AUTH_SOCK is not set")
+	}
+	logger.Info.Println("using ssh-agent at socket:", socket)
+
+	conn, err := dialAgent(socket)
+	if err != nil {
+		return fmt.Errorf("unable to connect to ssh-agent at socket %s. %+v", socket, err)
+	}
+	// the connection is kept open for the life of the program since agent signers need it
+	c.agent = agent.NewClient(conn)
+	return nil
+}
+
+// publicKeys returns all the signers which should be tried for public key authentication with a
+// host: keys from identity files added for all hosts, then the host's own signers (see
+// hostSigners), then keys held by ssh-agent.
+// The SSH client will not retry the "publickey" auth method after one publickey AuthMethod has
+// failed, so all keys must be offered by a single AuthMethod for every key to be tried.
+func (c *Connector) publicKeys(hostSigners ...ssh.Signer) ([]ssh.Signer, error) {
+	signers := make([]ssh.Signer, 0, len(c.signers)+len(hostSigners))
+	signers = append(signers, c.signers...)
+	signers = append(signers, hostSigners...)
+	if c.agent != nil {
+		agentSigners, err := c.agent.Signers()
+		if err != nil {
+			// still try the other keys if the agent can't be reached
+			logger.Warning.Printf("unable to get keys from ssh-agent. %+v", err)
+		}
+		signers = append(signers, agentSigners...)
+	}
+	return signers, nil
+}
@@ -0,0 +1,180 @@
+package ssh
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/BlaineEXE/octopus/internal/remote"
+	"github.com/BlaineEXE/octopus/internal/util/testutil"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+func newTestSigner(t *testing.T) (ssh.Signer, *ecdsa.PrivateKey) {
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate test key. %+v", err)
+	}
+	s, err := ssh.NewSignerFromKey(k)
+	if err != nil {
+		t.Fatalf("failed to create test signer. %+v", err)
+	}
+	return s, k
+}
+
+func TestConnector_UseAgent(t *testing.T) {
+	runtimeDialAgent := dialAgent
+	defer func() { dialAgent = runtimeDialAgent }()
+	runtimeSock := os.Getenv("SSH_AUTH_SOCK")
+	defer os.Setenv("SSH_AUTH_SOCK", runtimeSock)
+
+	fileSigner, _ := newTestSigner(t)
+	agentSigner, agentKey := newTestSigner(t)
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: agentKey}); err != nil {
+		t.Fatalf("failed to add key to test agent. %+v", err)
+	}
+	dialAgent = func(socket string) (net.Conn, error) {
+		if socket != "/test/agent.sock" {
+			return nil, fmt.Errorf("test agent dial error")
+		}
+		client, server := net.Pipe()
+		go agent.ServeAgent(keyring, server)
+		return client, nil
+	}
+
+	tests := []struct {
+		name          string
+		sock          string
+		identityFiles bool // add a signer as if read from an identity file
+		wantErr       bool
+		wantKeys      []ssh.PublicKey
+	}{
+		{"SSH_AUTH_SOCK unset", "", false, true, []ssh.PublicKey{}},
+		{"agent unreachable", "/bad/agent.sock", false, true, []ssh.PublicKey{}},
+		{"agent only", "/test/agent.sock", false, false,
+			[]ssh.PublicKey{agentSigner.PublicKey()}},
+		{"identity files tried before agent", "/test/agent.sock", true, false,
+			[]ssh.PublicKey{fileSigner.PublicKey(), agentSigner.PublicKey()}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Setenv("SSH_AUTH_SOCK", tt.sock)
+			c := NewConnector()
+			if tt.identityFiles {
+				c.signers = append(c.signers, fileSigner)
+			}
+			if err := c.UseAgent(); (err != nil) != tt.wantErr {
+				t.Errorf("Connector.UseAgent() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			signers, err := c.publicKeys()
+			assert.NoError(t, err)
+			gotKeys := []ssh.PublicKey{}
+			for _, s := range signers {
+				gotKeys = append(gotKeys, s.PublicKey())
+			}
+			assert.Equal(t, len(tt.wantKeys), len(gotKeys))
+			for i := range tt.wantKeys {
+				assert.Equal(t, tt.wantKeys[i].Marshal(), gotKeys[i].Marshal())
+			}
+		})
+	}
+}
+
+func TestConnector_AddIdentityFile(t *testing.T) {
+	tmpRoot, cleanup := testutil.TempDir("")
+	defer cleanup()
+
+	runtimeReadPassphrase := readPassphrase
+	defer func() { readPassphrase = runtimeReadPassphrase }()
+	passphraseReads := 0
+	readPassphrase = func(prompt string) ([]byte, error) {
+		passphraseReads++
+		return []byte("correct horse"), nil
+	}
+
+	// the same key in the OpenSSH format written by ssh-keygen, unencrypted and encrypted
+	pub, err := ioutil.ReadFile("testdata/id_ecdsa.pub")
+	if err != nil {
+		t.Fatalf("failed to read test public key. %+v", err)
+	}
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey(pub)
+	if err != nil {
+		t.Fatalf("failed to parse test public key. %+v", err)
+	}
+
+	notAKey := path.Join(tmpRoot, "not-a-key")
+	testutil.WriteFile(notAKey, "hello", 0600)
+
+	tests := []struct {
+		name            string
+		filePath        string
+		wantErr         bool
+		passphraseReads int
+	}{
+		{"unencrypted key", "testdata/id_ecdsa", false, 0},
+		{"encrypted key", "testdata/id_ecdsa_encrypted", false, 1},
+		{"encrypted key, wrong passphrase", "testdata/id_ecdsa_other_passphrase", true, 1},
+		{"key does not exist", path.Join(tmpRoot, "nope"), true, 0},
+		{"not a key", notAKey, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			passphraseReads = 0
+			c := NewConnector()
+			if err := c.AddIdentityFile(tt.filePath); (err != nil) != tt.wantErr {
+				t.Errorf("Connector.AddIdentityFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Equal(t, tt.passphraseReads, passphraseReads)
+			if tt.wantErr {
+				assert.Empty(t, c.signers)
+				return
+			}
+			// the decrypted key is kept so the passphrase doesn't need to be asked for again
+			assert.Len(t, c.signers, 1)
+			assert.Equal(t, publicKey.Marshal(), c.signers[0].PublicKey().Marshal())
+		})
+	}
+}
+
+func TestConnector_Connect_hostIdentityFiles(t *testing.T) {
+	tmpRoot, cleanup := testutil.TempDir("")
+	defer cleanup()
+
+	runtimeDialHost, runtimeReadPassphrase := dialHost, readPassphrase
+	defer func() { dialHost, readPassphrase = runtimeDialHost, runtimeReadPassphrase }()
+	events := []string{}
+	readPassphrase = func(prompt string) ([]byte, error) {
+		events = append(events, "passphrase")
+		return []byte("correct horse"), nil
+	}
+	dialHost = func(network, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+		events = append(events, "dial "+addr)
+		return nil, fmt.Errorf("test dial error")
+	}
+
+	keyFile, err := filepath.Abs("testdata/id_ecdsa_encrypted")
+	assert.NoError(t, err)
+	sshConfigFile := path.Join(tmpRoot, "ssh_config")
+	testutil.WriteFile(sshConfigFile, "Host *\n  IdentityFile "+keyFile+"\n", 0644)
+
+	c := NewConnector()
+	assert.NoError(t, c.SSHConfigFile(sshConfigFile))
+	for _, h := range []string{"node-1", "node-2"} {
+		_, err := c.Connect(context.Background(), remote.Host{Address: h})
+		assert.Error(t, err)
+	}
+	// the passphrase is asked for once and before dialing so that the user's typing doesn't count
+	// toward the connect timeout
+	assert.Equal(t, []string{"passphrase", "dial node-1:22", "dial node-2:22"}, events)
+}
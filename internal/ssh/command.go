@@ -2,9 +2,16 @@ package ssh
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/BlaineEXE/octopus/internal/logger"
+	"github.com/BlaineEXE/octopus/internal/remote"
+	"github.com/BlaineEXE/octopus/internal/util"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -20,24 +27,222 @@ var runCommand = func(s *ssh.Session, command string) error {
 	return s.Run(command)
 }
 
+var setenv = func(s *ssh.Session, name, value string) error {
+	return s.Setenv(name, value)
+}
+
+// Pseudo-terminals are given a terminal type and size which commands everywhere understand. Echo
+// is turned off so that stdin is not repeated in stdout.
+const (
+	ttyTerm   = "xterm"
+	ttyHeight = 24
+	ttyWidth  = 80
+)
+
+var ttyModes = ssh.TerminalModes{
+	ssh.ECHO:          0,
+	ssh.TTY_OP_ISPEED: 14400,
+	ssh.TTY_OP_OSPEED: 14400,
+}
+
+var requestPty = func(s *ssh.Session) error {
+	return s.RequestPty(ttyTerm, ttyHeight, ttyWidth, ttyModes)
+}
+
+var signalSession = func(s *ssh.Session, sig ssh.Signal) error {
+	return s.Signal(sig)
+}
+
+// Interrupted commands are sent SIGINT, then SIGTERM if they are still running after the grace
+// period, and then SIGKILL after another grace period.
+var interruptGracePeriod = 5 * time.Second
+
+// Cleanup commands are not interrupted, so they are given their own short time limit instead.
+var cleanupTimeout = 10 * time.Second
+
 // RunCommand runs the command on the Actor's remote host.
 func (a *Actor) RunCommand(command string) (stdout, stderr *bytes.Buffer, err error) {
+	stdout = new(bytes.Buffer)
+	stderr = new(bytes.Buffer)
+	err = a.StreamCommand(&remote.Command{Command: command, Stdout: stdout, Stderr: stderr})
+	return
+}
+
+// StreamCommand runs the command on the Actor's remote host, writing output to the command's
+// writers as it is received. Once the actor's context is canceled, the command is interrupted.
+// Cleanup commands are never interrupted, and they time out after cleanupTimeout if the command
+// timeout isn't shorter.
+func (a *Actor) StreamCommand(c *remote.Command) (err error) {
+	ctx, commandTimeout := a.ctx, a.commandTimeout
+	if c.Cleanup {
+		ctx = context.Background()
+		if commandTimeout == 0 || commandTimeout > cleanupTimeout {
+			commandTimeout = cleanupTimeout
+		}
+	}
+	if ctx.Err() != nil {
+		return &remote.InterruptedError{Operation: "command"}
+	}
 	logger.Info.Println("establishing client connection to host:", a.host)
 	session, err := newSession(a.sshClient)
 	if err != nil {
-		err = fmt.Errorf("failed to run command on host %s: %+v", a.host, err)
-		return
+		return fmt.Errorf("failed to run command on host %s: %+v", a.host, err)
 	}
 	defer closeSession(session)
 
+	command := a.setEnv(session, c.Command)
+
+	stdout, stderr := c.Stdout, c.Stderr
+	if a.tty {
+		if err := requestPty(session); err != nil {
+			return fmt.Errorf("failed to allocate pseudo-terminal on host %s: %+v", a.host, err)
+		}
+		o, e := &crlfWriter{w: stdout}, &crlfWriter{w: stderr}
+		defer o.Flush()
+		defer e.Flush()
+		stdout, stderr = o, e
+	}
+
 	logger.Info.Println("running user command on host:", a.host)
-	stdout = new(bytes.Buffer)
-	stderr = new(bytes.Buffer)
 	session.Stdout = stdout
 	session.Stderr = stderr
+	if c.Stdin != nil {
+		// use a pipe instead of session.Stdin so that waiting for the command doesn't also wait for
+		// stdin to be read to the end, which may never happen
+		w, err := session.StdinPipe()
+		if err != nil {
+			return fmt.Errorf("failed to connect stdin to command on host %s: %+v", a.host, err)
+		}
+		go func() {
+			io.Copy(w, c.Stdin)
+			w.Close() // the remote command gets EOF
+		}()
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- runCommand(session, command) }()
+	var timeout <-chan time.Time
+	if commandTimeout > 0 {
+		timer := time.NewTimer(commandTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
 
-	if err = runCommand(session, command); err != nil {
-		err = fmt.Errorf("command run error: %+v", err)
+	select {
+	case err = <-done:
+		if ee, ok := err.(*ssh.ExitError); ok {
+			err = newExitError(ee)
+		} else if err != nil {
+			err = fmt.Errorf("command run error: %+v", err)
+		}
+	case <-timeout:
+		logger.Info.Println("killing timed out command on host:", a.host)
+		// not all ssh servers support signals, but closing the session stops waiting for the command
+		// regardless
+		signalSession(session, ssh.SIGKILL)
+		closeSession(session)
+		<-done // the session no longer writes to stdout and stderr once the command returns
+		err = &remote.TimeoutError{Operation: "command", Limit: commandTimeout}
+	case <-ctx.Done():
+		a.interrupt(session, done)
+		err = &remote.InterruptedError{Operation: "command"}
 	}
 	return
 }
+
+// Stop the interrupted command, giving it a chance to clean up after itself before it is killed.
+// Like for timed out commands, the session is closed in case the ssh server doesn't support
+// signals.
+func (a *Actor) interrupt(session *ssh.Session, done <-chan error) {
+	for _, sig := range []ssh.Signal{ssh.SIGINT, ssh.SIGTERM} {
+		logger.Info.Printf("sending SIG%s to interrupted command on host %s", sig, a.host)
+		signalSession(session, sig)
+		timer := time.NewTimer(interruptGracePeriod)
+		select {
+		case <-done:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+	logger.Info.Println("killing interrupted command on host:", a.host)
+	signalSession(session, ssh.SIGKILL)
+	closeSession(session)
+	<-done
+}
+
+// Set the actor's environment variables for the session, and return the command to run. Hosts only
+// accept the variables allowed by AcceptEnv in their sshd config, so if any variable is refused, the
+// returned command exports all of the variables before running.
+func (a *Actor) setEnv(s *ssh.Session, command string) string {
+	names := make([]string, 0, len(a.env))
+	for n := range a.env {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		if err := setenv(s, n, a.env[n]); err != nil {
+			logger.Info.Printf("host %s refused environment variable %s; exporting variables in the "+
+				"command instead. %+v", a.host, n, err)
+			exports := make([]string, 0, len(names))
+			for _, n := range names {
+				exports = append(exports, n+"="+util.ShellQuote(a.env[n]))
+			}
+			return "export " + strings.Join(exports, " ") + "; " + command
+		}
+	}
+	return command
+}
+
+// A crlfWriter writes to the underlying writer with each CRLF ("\r\n") replaced by a newline.
+// Pseudo-terminals end lines with CRLF. A carriage return at the end of a write is held back until
+// the next write shows whether a newline follows it or until the writer is flushed.
+type crlfWriter struct {
+	w  io.Writer
+	cr bool // a carriage return is being held back
+}
+
+func (c *crlfWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	out := make([]byte, 0, len(p)+1)
+	if c.cr && p[0] != '\n' {
+		out = append(out, '\r')
+	}
+	c.cr = false
+	for i, b := range p {
+		if b == '\r' {
+			if i == len(p)-1 {
+				c.cr = true
+				continue
+			}
+			if p[i+1] == '\n' {
+				continue
+			}
+		}
+		out = append(out, b)
+	}
+	if _, err := c.w.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush writes a carriage return which is being held back.
+func (c *crlfWriter) Flush() error {
+	if !c.cr {
+		return nil
+	}
+	c.cr = false
+	_, err := c.w.Write([]byte{'\r'})
+	return err
+}
+
+func newExitError(e *ssh.ExitError) *remote.ExitError {
+	s := remote.ExitStatus{Code: e.ExitStatus(), Signal: e.Signal()}
+	if s.Signal != "" {
+		s.Code = -1
+	}
+	return &remote.ExitError{Status: s, Message: e.Msg()}
+}
@@ -0,0 +1,343 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BlaineEXE/octopus/internal/remote"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestActor_RunCommand_timeout(t *testing.T) {
+	runtimeNewSession, runtimeCloseSession := newSession, closeSession
+	runtimeRunCommand, runtimeSignalSession := runCommand, signalSession
+	defer func() {
+		newSession, closeSession = runtimeNewSession, runtimeCloseSession
+		runCommand, signalSession = runtimeRunCommand, runtimeSignalSession
+	}()
+
+	var closed chan struct{}
+	killed := false
+	newSession = func(c *ssh.Client) (*ssh.Session, error) {
+		closed = make(chan struct{})
+		killed = false
+		return &ssh.Session{}, nil
+	}
+	closeSession = func(s *ssh.Session) error {
+		select {
+		case <-closed:
+		default:
+			close(closed)
+		}
+		return nil
+	}
+	signalSession = func(s *ssh.Session, sig ssh.Signal) error {
+		killed = sig == ssh.SIGKILL
+		return nil
+	}
+	// commands beginning with "sleep" run until the session is closed
+	runCommand = func(s *ssh.Session, command string) error {
+		if command == "sleep" {
+			<-closed
+			return fmt.Errorf("session closed")
+		}
+		s.Stdout.Write([]byte("done"))
+		return nil
+	}
+
+	tests := []struct {
+		name       string
+		timeout    time.Duration
+		command    string
+		wantStdout string
+		wantErr    bool
+	}{
+		{"fast command with timeout", time.Second, "fast", "done", false},
+		{"fast command without timeout", 0, "fast", "done", false},
+		{"slow command times out", 50 * time.Millisecond, "sleep", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newActor("test-host", nil)
+			a.commandTimeout = tt.timeout
+			stdout, _, err := a.RunCommand(tt.command)
+			assert.Equal(t, tt.wantStdout, stdout.String())
+			if !tt.wantErr {
+				assert.NoError(t, err)
+				assert.False(t, killed)
+				return
+			}
+			assert.IsType(t, &remote.TimeoutError{}, err)
+			assert.True(t, killed)
+		})
+	}
+}
+
+func TestActor_StreamCommand_env(t *testing.T) {
+	runtimeNewSession, runtimeCloseSession := newSession, closeSession
+	runtimeRunCommand, runtimeSetenv := runCommand, setenv
+	defer func() {
+		newSession, closeSession = runtimeNewSession, runtimeCloseSession
+		runCommand, setenv = runtimeRunCommand, runtimeSetenv
+	}()
+
+	newSession = func(c *ssh.Client) (*ssh.Session, error) { return &ssh.Session{}, nil }
+	closeSession = func(s *ssh.Session) error { return nil }
+	var ran string
+	runCommand = func(s *ssh.Session, command string) error {
+		ran = command
+		return nil
+	}
+	var set map[string]string
+	refuse := ""
+	setenv = func(s *ssh.Session, name, value string) error {
+		if name == refuse {
+			return fmt.Errorf("ssh: setenv failed")
+		}
+		set[name] = value
+		return nil
+	}
+
+	tests := []struct {
+		name        string
+		env         map[string]string
+		refuse      string
+		wantSet     map[string]string
+		wantCommand string
+	}{
+		{"no env", map[string]string{}, "", map[string]string{}, "hostname"},
+		{"env accepted",
+			map[string]string{"VERSION": "1.2", "HTTP_PROXY": "http://proxy:3128"}, "",
+			map[string]string{"VERSION": "1.2", "HTTP_PROXY": "http://proxy:3128"}, "hostname"},
+		{"env refused",
+			map[string]string{"VERSION": "1.2", "HTTP_PROXY": "http://proxy:3128"}, "VERSION",
+			map[string]string{"HTTP_PROXY": "http://proxy:3128"},
+			"export HTTP_PROXY='http://proxy:3128' VERSION='1.2'; hostname"},
+		{"refused values are quoted",
+			map[string]string{"GREETING": "it's $HOME"}, "GREETING",
+			map[string]string{},
+			`export GREETING='it'\''s $HOME'; hostname`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set = map[string]string{}
+			refuse = tt.refuse
+			a := newActor("test-host", nil)
+			a.env = tt.env
+			_, _, err := a.RunCommand("hostname")
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantSet, set)
+			assert.Equal(t, tt.wantCommand, ran)
+		})
+	}
+}
+
+func TestActor_StreamCommand_tty(t *testing.T) {
+	runtimeNewSession, runtimeCloseSession := newSession, closeSession
+	runtimeRunCommand, runtimeRequestPty := runCommand, requestPty
+	defer func() {
+		newSession, closeSession = runtimeNewSession, runtimeCloseSession
+		runCommand, requestPty = runtimeRunCommand, runtimeRequestPty
+	}()
+
+	newSession = func(c *ssh.Client) (*ssh.Session, error) { return &ssh.Session{}, nil }
+	closeSession = func(s *ssh.Session) error { return nil }
+	// output is written in pieces like a terminal might
+	runCommand = func(s *ssh.Session, command string) error {
+		for _, w := range []string{"one\r", "\ntwo\r\nthree\r", "\rfour\r"} {
+			s.Stdout.Write([]byte(w))
+		}
+		return nil
+	}
+	var ptys int
+	var ptyErr error
+	requestPty = func(s *ssh.Session) error {
+		ptys++
+		return ptyErr
+	}
+
+	tests := []struct {
+		name       string
+		tty        bool
+		ptyErr     error
+		wantPtys   int
+		wantStdout string
+		wantErr    bool
+	}{
+		{"without tty", false, nil, 0, "one\r\ntwo\r\nthree\r\rfour\r", false},
+		{"with tty", true, nil, 1, "one\ntwo\nthree\r\rfour\r", false},
+		{"pty refused", true, fmt.Errorf("pty-req failed"), 1, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ptys, ptyErr = 0, tt.ptyErr
+			a := newActor("test-host", nil)
+			a.tty = tt.tty
+			stdout, _, err := a.RunCommand("top -b -n 1")
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.wantPtys, ptys)
+			assert.Equal(t, tt.wantStdout, stdout.String())
+		})
+	}
+}
+
+func Test_crlfWriter(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []string
+		want   string
+	}{
+		{"no line endings", []string{"abc"}, "abc"},
+		{"crlf", []string{"a\r\nb\r\n"}, "a\nb\n"},
+		{"plain newlines", []string{"a\nb\n"}, "a\nb\n"},
+		{"lone carriage returns", []string{"a\rb\r\r\n"}, "a\rb\r\n"},
+		{"crlf split across writes", []string{"a\r", "\nb\r", "", "\n"}, "a\nb\n"},
+		{"carriage return at end", []string{"a\r", "b\r"}, "a\rb\r"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := new(bytes.Buffer)
+			w := &crlfWriter{w: b}
+			for _, s := range tt.writes {
+				n, err := w.Write([]byte(s))
+				assert.NoError(t, err)
+				assert.Equal(t, len(s), n)
+			}
+			assert.NoError(t, w.Flush())
+			assert.Equal(t, tt.want, b.String())
+		})
+	}
+}
+
+func TestActor_StreamCommand_interrupt(t *testing.T) {
+	runtimeNewSession, runtimeCloseSession := newSession, closeSession
+	runtimeRunCommand, runtimeSignalSession := runCommand, signalSession
+	runtimeGracePeriod := interruptGracePeriod
+	defer func() {
+		newSession, closeSession = runtimeNewSession, runtimeCloseSession
+		runCommand, signalSession = runtimeRunCommand, runtimeSignalSession
+		interruptGracePeriod = runtimeGracePeriod
+	}()
+	interruptGracePeriod = 20 * time.Millisecond
+
+	// commands exit when they get the signal named by the command or when the session is closed
+	var exit chan struct{}
+	var signals []ssh.Signal
+	var closed bool
+	var lock sync.Mutex
+	newSession = func(c *ssh.Client) (*ssh.Session, error) {
+		exit = make(chan struct{})
+		signals, closed = []ssh.Signal{}, false
+		return &ssh.Session{}, nil
+	}
+	closeSession = func(s *ssh.Session) error {
+		lock.Lock()
+		defer lock.Unlock()
+		if !closed {
+			closed = true
+			close(exit)
+		}
+		return nil
+	}
+	var command string
+	signalSession = func(s *ssh.Session, sig ssh.Signal) error {
+		lock.Lock()
+		defer lock.Unlock()
+		signals = append(signals, sig)
+		if string(sig) == command && !closed {
+			closed = true
+			close(exit)
+		}
+		return nil
+	}
+	runCommand = func(s *ssh.Session, command string) error {
+		<-exit
+		return &ssh.ExitError{}
+	}
+
+	tests := []struct {
+		command     string
+		wantSignals []ssh.Signal
+	}{
+		{"INT", []ssh.Signal{ssh.SIGINT}},
+		{"TERM", []ssh.Signal{ssh.SIGINT, ssh.SIGTERM}},
+		{"ignores signals", []ssh.Signal{ssh.SIGINT, ssh.SIGTERM, ssh.SIGKILL}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			command = tt.command
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(10*time.Millisecond, cancel)
+			a := newActor("test-host", nil)
+			a.ctx = ctx
+			_, _, err := a.RunCommand(tt.command)
+			assert.IsType(t, &remote.InterruptedError{}, err)
+			lock.Lock()
+			defer lock.Unlock()
+			assert.Equal(t, tt.wantSignals, signals)
+		})
+	}
+}
+
+func TestActor_StreamCommand_cleanup(t *testing.T) {
+	runtimeNewSession, runtimeCloseSession := newSession, closeSession
+	runtimeRunCommand, runtimeSignalSession := runCommand, signalSession
+	runtimeCleanupTimeout := cleanupTimeout
+	defer func() {
+		newSession, closeSession = runtimeNewSession, runtimeCloseSession
+		runCommand, signalSession = runtimeRunCommand, runtimeSignalSession
+		cleanupTimeout = runtimeCleanupTimeout
+	}()
+	cleanupTimeout = 20 * time.Millisecond
+
+	var exit chan struct{}
+	var lock sync.Mutex
+	ran := []string{}
+	newSession = func(c *ssh.Client) (*ssh.Session, error) {
+		exit = make(chan struct{})
+		return &ssh.Session{}, nil
+	}
+	closeSession = func(s *ssh.Session) error { return nil }
+	signalSession = func(s *ssh.Session, sig ssh.Signal) error {
+		if sig == ssh.SIGKILL {
+			close(exit)
+		}
+		return nil
+	}
+	runCommand = func(s *ssh.Session, command string) error {
+		lock.Lock()
+		ran = append(ran, command)
+		lock.Unlock()
+		if command == "hang" {
+			<-exit
+			return &ssh.ExitError{}
+		}
+		return nil
+	}
+
+	// octopus has already been interrupted
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	a := newActor("test-host", nil)
+	a.ctx = ctx
+	run := func(command string, cleanup bool) error {
+		return a.StreamCommand(&remote.Command{Command: command, Stdout: new(bytes.Buffer),
+			Stderr: new(bytes.Buffer), Cleanup: cleanup})
+	}
+
+	assert.IsType(t, &remote.InterruptedError{}, run("echo hi", false))
+	assert.NoError(t, run("rm -rf /tmp/octopus-script.1", true))
+	// cleanup commands are given their own short time limit
+	err := run("hang", true)
+	if assert.IsType(t, &remote.TimeoutError{}, err) {
+		assert.Equal(t, 20*time.Millisecond, err.(*remote.TimeoutError).Limit)
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	assert.Equal(t, []string{"rm -rf /tmp/octopus-script.1", "hang"}, ran)
+}
@@ -1,77 +1,370 @@
 package ssh
 
 import (
+	"context"
 	"fmt"
-	"io/ioutil"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/BlaineEXE/octopus/internal/logger"
 	"github.com/BlaineEXE/octopus/internal/remote"
+	"github.com/BlaineEXE/octopus/internal/util"
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+const (
+	defaultUser           = "root"
+	defaultPort           = 22
+	defaultConnectTimeout = 30 * time.Second
 )
 
 // A Connector is able to make SSH connections to remote hosts.
 type Connector struct {
-	clientConfig *ssh.ClientConfig
-	port         uint16
+	clientConfig *ssh.ClientConfig // config shared by all hosts; copied and modified for each host
+	hostKeys     *hostKeyChecker
+
+	// The values set explicitly take precedence over values from the ssh config file. Empty values
+	// mean they have not been set.
+	user           string
+	port           uint16
+	jumpHosts      []string
+	connectTimeout time.Duration
+
+	commandTimeout time.Duration // zero means no limit
+	env            map[string]string
+	tty            bool
+
+	// connections to jump hosts are shared by all hosts behind them
+	bastions     map[string]*bastion
+	bastionsLock sync.Mutex
+
+	// all public key authentication is done with a single auth method; see publicKeys()
+	signers         []ssh.Signer // signers for keys read from identity files
+	signerFiles     map[string]bool
+	hostSignerCache map[string]ssh.Signer // signers for keys from hosts' own identity files
+	hostSignersLock sync.Mutex
+	agent           agent.Agent // ssh-agent client; nil if the agent is not used
+
+	// per-host settings are read lazily from the ssh config files
+	sshConfigFiles []string
+	sshConfigOnce  sync.Once
+	sshConfig      *sshConfig
+	sshConfigErr   error
 }
 
-// NewConnector returns a new SSH connector.
+// NewConnector returns a new SSH connector. By default, remote host keys are verified against the
+// user's known hosts file, and keys for new hosts are added to it. Per-host settings are read from
+// the user's and global OpenSSH client config files by default.
 func NewConnector() *Connector {
-	return &Connector{
-		clientConfig: &ssh.ClientConfig{
-			User:            "root",
-			Auth:            []ssh.AuthMethod{},
-			HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		},
-		port: 22,
+	c := &Connector{
+		clientConfig:    &ssh.ClientConfig{},
+		signers:         []ssh.Signer{},
+		signerFiles:     map[string]bool{},
+		hostSignerCache: map[string]ssh.Signer{},
+		sshConfigFiles:  []string{userSSHConfigFile, globalSSHConfigFile},
+		jumpHosts:       []string{},
+		env:             map[string]string{},
+		bastions:        map[string]*bastion{},
 	}
+	// the default mode is always valid
+	c.HostKeyChecking(AcceptNewHostKeyChecking, []string{})
+	return c
+}
+
+// Port sets the port on which remote connections will be made to hosts. The port set here takes
+// precedence over ports set in the ssh config file. If no port is set, the default port is 22.
+func (c *Connector) Port(p uint16) error {
+	c.port = p
+	return nil
 }
 
-// AddIdentityFile adds the identity file's key to the remote authentication methods ssh will try
-// when connecting to remote hosts.
-func (c *Connector) AddIdentityFile(filePath string) error {
-	logger.Info.Println("adding identity file:", filePath)
+// User sets the user on hosts to which connections will be made. The user set here takes
+// precedence over users set in the ssh config file. If no user is set, the default is 'root'.
+func (c *Connector) User(u string) error {
+	c.user = u
+	return nil
+}
 
-	key, err := ioutil.ReadFile(filePath)
-	if err != nil {
-		return err
+// ConnectTimeout sets the time limit for connecting to each host, including the ssh handshake and
+// authentication. The limit set here takes precedence over ConnectTimeout set in the ssh config
+// file. If no limit is set, the default is 30 seconds.
+func (c *Connector) ConnectTimeout(t time.Duration) error {
+	if t < 0 {
+		return fmt.Errorf("connect timeout %s is negative", t)
 	}
+	c.connectTimeout = t
+	return nil
+}
 
-	signer, err := ssh.ParsePrivateKey(key)
-	if err != nil {
-		return fmt.Errorf("unable to parse private key from file %s. %+v", filePath, err)
+// CommandTimeout sets the time limit for each command run on hosts. Commands which time out are
+// killed. A zero limit (the default) means commands are never timed out.
+func (c *Connector) CommandTimeout(t time.Duration) error {
+	if t < 0 {
+		return fmt.Errorf("command timeout %s is negative", t)
 	}
+	c.commandTimeout = t
+	return nil
+}
+
+var envNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
 
-	c.clientConfig.Auth = append(c.clientConfig.Auth, ssh.PublicKeys(signer))
+// Env sets environment variables for every command run on hosts. Variables are set with the ssh
+// "env" request, which hosts only accept for variables allowed by AcceptEnv in their sshd config.
+// If a host refuses any variable, all variables are instead exported by the command itself.
+func (c *Connector) Env(env map[string]string) error {
+	e := map[string]string{}
+	for n, v := range env {
+		if !envNameRegexp.MatchString(n) {
+			return fmt.Errorf("invalid environment variable name %q", n)
+		}
+		e[n] = v
+	}
+	c.env = e
 	return nil
 }
 
-// Port sets the port on which remote connections will be made to hosts. The default port is 22.
-func (c *Connector) Port(p uint16) error {
-	c.port = p
+// RequestTTY sets whether commands run on hosts are given a pseudo-terminal, like ssh -t. The
+// terminal's stdout and stderr are the same, so all output from such commands is stdout, and the
+// CRLF line endings the terminal writes are turned back into plain newlines. By default, commands
+// are not given a pseudo-terminal.
+func (c *Connector) RequestTTY(request bool) error {
+	c.tty = request
 	return nil
 }
 
-// User sets the user on hosts to which connections will be made. The default user is 'root'.
-func (c *Connector) User(u string) error {
-	c.clientConfig.User = u
+// HostKeyChecking sets how remote host keys are verified. The mode must be one of
+// HostKeyCheckingModes. Keys are checked against the user's known hosts file (~/.ssh/known_hosts),
+// the global known hosts file (/etc/ssh/ssh_known_hosts), and any additional known hosts files
+// given. The default mode is 'accept-new'.
+func (c *Connector) HostKeyChecking(mode string, knownHostsFiles []string) error {
+	k, err := newHostKeyChecker(mode, knownHostsFiles)
+	if err != nil {
+		return err
+	}
+	c.hostKeys = k
+	c.clientConfig.HostKeyCallback = k.check
 	return nil
 }
 
-var dialHost = ssh.Dial
+// SSHConfigFile sets the OpenSSH client config file from which per-host settings (HostName, User,
+// Port, IdentityFile, ConnectTimeout, and ProxyJump) are read. This replaces the default user and
+// global config files. If the path is empty or "none", no ssh config file is read.
+func (c *Connector) SSHConfigFile(filePath string) error {
+	if filePath == "" || filePath == "none" {
+		c.sshConfigFiles = []string{}
+		return nil
+	}
+	p, err := util.AbsPath(filePath)
+	if err != nil {
+		return err
+	}
+	c.sshConfigFiles = []string{p}
+	return nil
+}
+
+func (c *Connector) loadSSHConfig() (*sshConfig, error) {
+	c.sshConfigOnce.Do(func() {
+		c.sshConfig, c.sshConfigErr = loadSSHConfig(c.sshConfigFiles...)
+	})
+	return c.sshConfig, c.sshConfigErr
+}
+
+// hostSettings are the settings used to connect to a single host
+type hostSettings struct {
+	hostName       string // the real host name or address to connect to
+	port           uint16
+	user           string
+	identityFiles  []string
+	connectTimeout time.Duration
+	jumpHosts      []string
+}
+
+// Resolve the settings for connecting to the host. The user and port given explicitly have the
+// highest precedence (empty and 0 mean unset), followed by values from the ssh config file,
+// followed by defaults.
+func (c *Connector) resolve(host, user string, port uint16) (*hostSettings, error) {
+	conf, err := c.loadSSHConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &hostSettings{
+		hostName:      host,
+		port:          defaultPort,
+		user:          defaultUser,
+		identityFiles: []string{},
+		jumpHosts:     proxyJumpHosts(conf, host),
+	}
+	if v := conf.get(host, "port"); v != "" {
+		p, err := strconv.ParseUint(v, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port %q in ssh config for host %s. %+v", v, host, err)
+		}
+		s.port = uint16(p)
+	}
+	if port != 0 {
+		s.port = port
+	}
+	if v := conf.get(host, "user"); v != "" {
+		s.user = v
+	}
+	if user != "" {
+		s.user = user
+	}
+	portStr := strconv.Itoa(int(s.port))
+	if v := conf.get(host, "hostname"); v != "" {
+		s.hostName = expandSSHConfigTokens(v, host, portStr, s.user)
+	}
+	for _, f := range conf.getAll(host, "identityfile") {
+		p, err := util.AbsPath(expandSSHConfigTokens(f, host, portStr, s.user))
+		if err != nil {
+			return nil, fmt.Errorf("invalid identity file %q in ssh config for host %s. %+v", f, host, err)
+		}
+		s.identityFiles = append(s.identityFiles, p)
+	}
+	if v := conf.get(host, "connecttimeout"); v != "" {
+		t, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid connect timeout %q in ssh config for host %s. %+v", v, host, err)
+		}
+		s.connectTimeout = time.Duration(t) * time.Second
+	}
+	if c.connectTimeout != 0 {
+		s.connectTimeout = c.connectTimeout
+	}
+	if s.connectTimeout == 0 {
+		s.connectTimeout = defaultConnectTimeout
+	}
+	return s, nil
+}
+
+// the ssh client config for connecting to a host with its own signers in addition to the
+// connector's keys
+func (c *Connector) clientConfigFor(s *hostSettings, hostSigners []ssh.Signer) *ssh.ClientConfig {
+	conf := *c.clientConfig
+	conf.User = s.user
+	conf.Timeout = s.connectTimeout
+	if c.hostKeys != nil {
+		conf.HostKeyAlgorithms = c.hostKeys.algorithms(net.JoinHostPort(s.hostName, strconv.Itoa(int(s.port))))
+	}
+	conf.Auth = []ssh.AuthMethod{ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+		return c.publicKeys(hostSigners...)
+	})}
+	return &conf
+}
+
+// ssh.Dial does not limit the time taken by the ssh handshake, so a host which accepts connections
+// but never responds would hang forever.
+var dialHost = func(network, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	conn, err := net.DialTimeout(network, addr, config.Timeout)
+	if err != nil {
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			err = &remote.TimeoutError{Operation: "connecting to " + addr, Limit: config.Timeout}
+		}
+		return nil, &remote.UnreachableError{Err: err}
+	}
+	return newClientConn(conn, addr, config)
+}
+
+// Connections tunneled through jump hosts do not support deadlines, so the handshake is limited
+// by closing the connection if it takes too long.
+var newClientConn = func(conn net.Conn, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	var timer *time.Timer
+	if config.Timeout > 0 {
+		timer = time.AfterFunc(config.Timeout, func() { conn.Close() })
+	}
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if timer != nil && !timer.Stop() {
+		if err == nil {
+			c.Close()
+		}
+		return nil, &remote.TimeoutError{Operation: "ssh handshake with " + addr, Limit: config.Timeout}
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// Dial the host, giving up if the context is canceled first. The dial is not stopped, so its client
+// is closed once it connects.
+func (c *Connector) dialContext(ctx context.Context, s *hostSettings) (*ssh.Client, error) {
+	type dialed struct {
+		client *ssh.Client
+		err    error
+	}
+	ch := make(chan dialed, 1)
+	go func() {
+		client, err := c.dial(s)
+		ch <- dialed{client, err}
+	}()
+	select {
+	case d := <-ch:
+		return d.client, d.err
+	case <-ctx.Done():
+		go func() {
+			if d := <-ch; d.client != nil {
+				d.client.Close()
+			}
+		}()
+		return nil, &remote.InterruptedError{Operation: "connecting to " + s.hostName}
+	}
+}
 
 // Connect connects to the host via ssh with the options that have been previously set and returns
-// an actor which can be called to perform tasks on the remote host.
-func (c *Connector) Connect(host string) (remote.Actor, error) {
-	if len(c.clientConfig.Auth) == 0 {
+// an actor which can be called to perform tasks on the remote host. The host's own user and port
+// take precedence over the user and port set on the connector. Once the context is canceled,
+// connecting is given up, and the actor's commands are interrupted.
+func (c *Connector) Connect(ctx context.Context, host remote.Host) (remote.Actor, error) {
+	user, port := c.user, c.port
+	if host.User != "" {
+		user = host.User
+	}
+	if host.Port != 0 {
+		port = host.Port
+	}
+	s, err := c.resolve(host.Address, user, port)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to host %s. %+v", host, err)
+	}
+	if len(c.jumpHosts) > 0 {
+		s.jumpHosts = c.jumpHosts
+	}
+	if len(c.signers) == 0 && c.agent == nil && len(s.identityFiles) == 0 {
 		return nil, fmt.Errorf(
 			"cannot connect to host %s. no ssh authorization methods have been specified", host)
 	}
-	logger.Info.Println("dialing host:", host)
-	client, err := dialHost("tcp", fmt.Sprintf("%s:%d", host, c.port), c.clientConfig)
+
+	logger.Info.Printf("dialing host %s at %s port %d as user %s through jump hosts %v",
+		host, s.hostName, s.port, s.user, s.jumpHosts)
+	client, err := c.dialContext(ctx, s)
 	if err != nil {
-		return nil, fmt.Errorf("failed to dial host %s. %+v", host, err)
+		switch e := err.(type) {
+		case *remote.TimeoutError, *remote.InterruptedError:
+			return nil, err
+		case *remote.UnreachableError:
+			if _, ok := e.Err.(*remote.TimeoutError); ok {
+				return nil, err
+			}
+			return nil, &remote.UnreachableError{Err: fmt.Errorf("failed to dial host %s. %+v", host, e.Err)}
+		}
+		err = fmt.Errorf("failed to dial host %s. %+v", host, err)
+		// the ssh package does not have a distinct error type for authentication failures
+		if strings.Contains(err.Error(), "unable to authenticate") {
+			return nil, &remote.AuthError{Err: err}
+		}
+		return nil, err
 	}
-	a := newActor(host, client)
+	a := newActor(host.String(), client)
+	a.ctx = ctx
+	a.commandTimeout = c.commandTimeout
+	a.env = c.env
+	a.tty = c.tty
 	return a, nil
 }
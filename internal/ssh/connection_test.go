@@ -0,0 +1,185 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/BlaineEXE/octopus/internal/remote"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestConnector_Connect(t *testing.T) {
+	runtimeDialHost := dialHost
+	defer func() { dialHost = runtimeDialHost }()
+	var dialed string
+	dialHost = func(network, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+		dialed = config.User + "@" + addr
+		return nil, fmt.Errorf("test dial error")
+	}
+
+	tests := []struct {
+		name       string
+		host       remote.Host
+		user       string // explicitly set user
+		port       uint16 // explicitly set port
+		wantDialed string
+	}{
+		{"defaults", remote.Host{Address: "node-1"}, "", 0, "root@node-1:22"},
+		{"connector user and port", remote.Host{Address: "node-1"}, "me", 2022, "me@node-1:2022"},
+		{"host user and port override connector", remote.Host{Address: "node-1", User: "admin", Port: 2222},
+			"me", 2022, "admin@node-1:2222"},
+		{"host port only", remote.Host{Address: "node-1", Port: 2222}, "me", 0, "me@node-1:2222"},
+		{"IPv6", remote.Host{Address: "fe80::1", Port: 2222}, "", 0, "root@[fe80::1]:2222"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewConnector()
+			assert.NoError(t, c.SSHConfigFile("none"))
+			assert.NoError(t, c.User(tt.user))
+			assert.NoError(t, c.Port(tt.port))
+			s, _ := newTestSigner(t)
+			c.signers = append(c.signers, s)
+
+			dialed = ""
+			_, err := c.Connect(context.Background(), tt.host)
+			assert.Error(t, err)
+			assert.Equal(t, tt.wantDialed, dialed)
+		})
+	}
+}
+
+func TestConnector_ConnectTimeout(t *testing.T) {
+	// a host which accepts connections but never responds to the ssh handshake
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen. %+v", err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	addr := l.Addr().(*net.TCPAddr)
+
+	c := NewConnector()
+	assert.NoError(t, c.SSHConfigFile("none"))
+	assert.Error(t, c.ConnectTimeout(-time.Second))
+	assert.NoError(t, c.ConnectTimeout(100*time.Millisecond))
+	s, _ := newTestSigner(t)
+	c.signers = append(c.signers, s)
+
+	start := time.Now()
+	_, err = c.Connect(context.Background(), remote.Host{Address: "127.0.0.1", Port: uint16(addr.Port)})
+	assert.True(t, time.Since(start) < 5*time.Second)
+	if assert.IsType(t, &remote.TimeoutError{}, err) {
+		assert.Equal(t, 100*time.Millisecond, err.(*remote.TimeoutError).Limit)
+	}
+}
+
+func TestConnector_Connect_unreachable(t *testing.T) {
+	// a port on which nothing listens
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen. %+v", err)
+	}
+	addr := l.Addr().(*net.TCPAddr)
+	l.Close()
+
+	c := NewConnector()
+	assert.NoError(t, c.SSHConfigFile("none"))
+	s, _ := newTestSigner(t)
+	c.signers = append(c.signers, s)
+
+	_, err = c.Connect(context.Background(), remote.Host{Address: "127.0.0.1", Port: uint16(addr.Port)})
+	if assert.IsType(t, &remote.UnreachableError{}, err) {
+		assert.Contains(t, err.Error(), "failed to dial host 127.0.0.1")
+	}
+}
+
+func TestConnector_Env(t *testing.T) {
+	c := NewConnector()
+	assert.NoError(t, c.Env(map[string]string{"HTTP_PROXY": "http://proxy:3128", "_v2": ""}))
+	assert.Equal(t, map[string]string{"HTTP_PROXY": "http://proxy:3128", "_v2": ""}, c.env)
+	for _, n := range []string{"", "2V", "MY-VAR", "A=B", "A B"} {
+		assert.Error(t, c.Env(map[string]string{n: "value"}), "name %q", n)
+	}
+}
+
+func TestConnector_Connect_authError(t *testing.T) {
+	serverSigner, _ := newTestSigner(t)
+	serverConfig := &ssh.ServerConfig{
+		PublicKeyCallback: func(c ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			return nil, fmt.Errorf("key rejected")
+		},
+	}
+	serverConfig.AddHostKey(serverSigner)
+	// a host which rejects all keys
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen. %+v", err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				ssh.NewServerConn(conn, serverConfig)
+				conn.Close()
+			}()
+		}
+	}()
+	addr := l.Addr().(*net.TCPAddr)
+
+	c := NewConnector()
+	assert.NoError(t, c.SSHConfigFile("none"))
+	assert.NoError(t, c.HostKeyChecking(NoHostKeyChecking, []string{}))
+	s, _ := newTestSigner(t)
+	c.signers = append(c.signers, s)
+
+	_, err = c.Connect(context.Background(), remote.Host{Address: "127.0.0.1", Port: uint16(addr.Port)})
+	assert.IsType(t, &remote.AuthError{}, err)
+}
+
+func TestConnector_Connect_interrupted(t *testing.T) {
+	// a host which accepts connections but never responds to the ssh handshake
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen. %+v", err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	addr := l.Addr().(*net.TCPAddr)
+
+	c := NewConnector()
+	assert.NoError(t, c.SSHConfigFile("none"))
+	assert.NoError(t, c.ConnectTimeout(time.Minute))
+	s, _ := newTestSigner(t)
+	c.signers = append(c.signers, s)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	_, err = c.Connect(ctx, remote.Host{Address: "127.0.0.1", Port: uint16(addr.Port)})
+	assert.True(t, time.Since(start) < 5*time.Second)
+	assert.IsType(t, &remote.InterruptedError{}, err)
+}
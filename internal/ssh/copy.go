@@ -5,6 +5,7 @@ import (
 	"os"
 	"time"
 
+	"github.com/BlaineEXE/octopus/internal/remote"
 	"github.com/pkg/sftp"
 )
 
@@ -22,6 +23,9 @@ var mkdirAllRemote = func(c *sftp.Client, dirPath string, mode os.FileMode) erro
 // CreateRemoteDir creates the dir as well as any nonexistent parents on the Actor's remote host if
 // any of the dirs do not exist. Return nil if the paths already exist.
 func (a *Actor) CreateRemoteDir(dirPath string, perms os.FileMode) error {
+	if a.ctx.Err() != nil {
+		return &remote.InterruptedError{Operation: "creating remote dir " + dirPath}
+	}
 	errMsg := "failed to create remote dir " + dirPath + ". %+v"
 	c, err := a.sftpClient()
 	if err != nil {
@@ -55,8 +59,12 @@ var closeRemoteFile = func(f *sftp.File) error {
 	return f.Close()
 }
 
-// CopyFileToRemote copies the file to the Actor's remote host at the remote file path.
+// CopyFileToRemote copies the file to the Actor's remote host at the remote file path. Files are
+// not copied once the actor is interrupted, but a copy which has already begun is finished.
 func (a *Actor) CopyFileToRemote(localSource *os.File, remoteFilePath string, info os.FileInfo) error {
+	if a.ctx.Err() != nil {
+		return &remote.InterruptedError{Operation: "copying file to " + remoteFilePath}
+	}
 	c, err := a.sftpClient()
 	if err != nil {
 		return err
@@ -0,0 +1,225 @@
+package ssh
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/BlaineEXE/octopus/internal/logger"
+	"github.com/BlaineEXE/octopus/internal/util"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	// StrictHostKeyChecking rejects any host whose key is not already in a known hosts file.
+	StrictHostKeyChecking = "strict"
+
+	// AcceptNewHostKeyChecking accepts the keys of hosts which are not yet in a known hosts file and
+	// adds them to the user's known hosts file. Hosts with keys which do not match the known key
+	// are still rejected.
+	AcceptNewHostKeyChecking = "accept-new"
+
+	// NoHostKeyChecking does not verify remote host keys at all.
+	NoHostKeyChecking = "off"
+)
+
+// HostKeyCheckingModes is the list of valid host key checking modes.
+var HostKeyCheckingModes = []string{StrictHostKeyChecking, AcceptNewHostKeyChecking, NoHostKeyChecking}
+
+var (
+	// new keys accepted in 'accept-new' mode are written to the user's known hosts file
+	userKnownHostsFile   = "~/.ssh/known_hosts"
+	globalKnownHostsFile = "/etc/ssh/ssh_known_hosts"
+)
+
+// A hostKeyChecker verifies remote host keys against OpenSSH known hosts files.
+type hostKeyChecker struct {
+	mode       string
+	extraFiles []string // known hosts files to read in addition to the user and global files
+
+	// known hosts files are read lazily, and only once, when the first host key is checked
+	loadOnce sync.Once
+	userFile string // file to which new host keys are added
+	known    ssh.HostKeyCallback
+	loadErr  error
+
+	writeLock sync.Mutex
+	accepted  map[string]bool // known hosts lines added during this run
+}
+
+func newHostKeyChecker(mode string, extraFiles []string) (*hostKeyChecker, error) {
+	if !isValidHostKeyCheckingMode(mode) {
+		return nil, fmt.Errorf("invalid host key checking mode %q. must be one of %v", mode, HostKeyCheckingModes)
+	}
+	return &hostKeyChecker{
+		mode:       mode,
+		extraFiles: extraFiles,
+		accepted:   map[string]bool{},
+	}, nil
+}
+
+func isValidHostKeyCheckingMode(mode string) bool {
+	for _, m := range HostKeyCheckingModes {
+		if mode == m {
+			return true
+		}
+	}
+	return false
+}
+
+// lazily read known hosts files so they are only read if a connection is actually made
+func (k *hostKeyChecker) load() (ssh.HostKeyCallback, error) {
+	k.loadOnce.Do(func() {
+		k.userFile, k.loadErr = util.AbsPath(userKnownHostsFile)
+		if k.loadErr != nil {
+			return
+		}
+		files := append([]string{k.userFile, globalKnownHostsFile}, k.extraFiles...)
+		existing := []string{}
+		for _, f := range files {
+			a, err := util.AbsPath(f)
+			if err != nil {
+				k.loadErr = err
+				return
+			}
+			if _, err := os.Stat(a); err != nil {
+				if !os.IsNotExist(err) {
+					k.loadErr = fmt.Errorf("could not read known hosts file %s. %+v", a, err)
+					return
+				}
+				logger.Info.Println("known hosts file does not exist:", a)
+				continue
+			}
+			existing = append(existing, a)
+		}
+		logger.Info.Println("reading known hosts files:", existing)
+		k.known, k.loadErr = knownhosts.New(existing...)
+		if k.loadErr != nil {
+			k.loadErr = fmt.Errorf("failed to parse known hosts files %v. %+v", existing, k.loadErr)
+		}
+	})
+	return k.known, k.loadErr
+}
+
+// check is an ssh.HostKeyCallback which verifies the host key according to the checking mode.
+func (k *hostKeyChecker) check(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	if k.mode == NoHostKeyChecking {
+		return nil
+	}
+
+	known, err := k.load()
+	if err != nil {
+		return err
+	}
+
+	err = known(hostname, remote, key)
+	keyErr, ok := err.(*knownhosts.KeyError)
+	if !ok {
+		// either no error or an error which isn't an unknown/mismatched key (e.g., revoked key)
+		return err
+	}
+
+	fingerprint := ssh.FingerprintSHA256(key)
+	for _, want := range keyErr.Want {
+		// a mismatch can signify a man-in-the-middle attack, so never accept a mismatched key. Keys of
+		// other types are only known keys the host didn't present, which is not a mismatch.
+		if want.Key.Type() == key.Type() {
+			return fmt.Errorf("REMOTE HOST IDENTIFICATION HAS CHANGED for host %s! "+
+				"host presented %s key with fingerprint %s which does not match known key at %s:%d",
+				hostname, key.Type(), fingerprint, want.Filename, want.Line)
+		}
+	}
+
+	if k.mode == StrictHostKeyChecking {
+		return fmt.Errorf("host key verification failed for host %s. no known host key for %s key with fingerprint %s",
+			hostname, key.Type(), fingerprint)
+	}
+
+	return k.accept(hostname, key)
+}
+
+// The host key algorithms the ssh package offers by default, in its order of preference
+var defaultHostKeyAlgorithms = []string{
+	ssh.CertAlgoRSAv01, ssh.CertAlgoDSAv01, ssh.CertAlgoECDSA256v01,
+	ssh.CertAlgoECDSA384v01, ssh.CertAlgoECDSA521v01, ssh.CertAlgoED25519v01,
+	ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521,
+	ssh.KeyAlgoRSA, ssh.KeyAlgoDSA,
+	ssh.KeyAlgoED25519,
+}
+
+// algorithms returns the host key algorithms to offer to the host. Like OpenSSH, algorithms for
+// the types of keys already known for the host are preferred so that the host presents a key which
+// can be checked rather than a key of another type. Nil (the ssh package's defaults) is returned if
+// no keys are known for the host.
+func (k *hostKeyChecker) algorithms(hostname string) []string {
+	if k.mode == NoHostKeyChecking {
+		return nil
+	}
+	known, err := k.load()
+	if err != nil {
+		return nil // the error is reported when the host's key is checked
+	}
+	// known hosts only lists the keys known for a host when it is given a key which doesn't match
+	keyErr, ok := known(hostname, probeAddr(hostname), probeKey{}).(*knownhosts.KeyError)
+	if !ok || len(keyErr.Want) == 0 {
+		return nil
+	}
+	knownTypes := map[string]bool{}
+	for _, want := range keyErr.Want {
+		knownTypes[want.Key.Type()] = true
+	}
+	preferred, others := []string{}, []string{}
+	for _, a := range defaultHostKeyAlgorithms {
+		if knownTypes[a] {
+			preferred = append(preferred, a)
+		} else {
+			others = append(others, a)
+		}
+	}
+	return append(preferred, others...)
+}
+
+// A probeKey is never a known host key.
+type probeKey struct{}
+
+func (probeKey) Type() string                                 { return "octopus-probe" }
+func (probeKey) Marshal() []byte                              { return []byte("octopus-probe") }
+func (probeKey) Verify(data []byte, sig *ssh.Signature) error { return fmt.Errorf("probe key") }
+
+// A probeAddr is the address of a host which hasn't been connected to yet.
+type probeAddr string
+
+func (a probeAddr) Network() string { return "tcp" }
+func (a probeAddr) String() string  { return string(a) }
+
+// add a new host key to the user's known hosts file
+func (k *hostKeyChecker) accept(hostname string, key ssh.PublicKey) error {
+	k.writeLock.Lock()
+	defer k.writeLock.Unlock()
+
+	line := knownhosts.Line([]string{hostname}, key)
+	if k.accepted[line] {
+		return nil // e.g., the same host is listed more than once
+	}
+	k.accepted[line] = true
+	if _, err := os.Stat(filepath.Dir(k.userFile)); err != nil {
+		// don't create the user's ssh dir; just accept the key for this connection
+		logger.Warning.Printf("accepting %s key with fingerprint %s for host %s without saving it. %+v",
+			key.Type(), ssh.FingerprintSHA256(key), hostname, err)
+		return nil
+	}
+	f, err := os.OpenFile(k.userFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to add host key for %s to known hosts file %s. %+v", hostname, k.userFile, err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(line + "\n"); err != nil {
+		return fmt.Errorf("failed to add host key for %s to known hosts file %s. %+v", hostname, k.userFile, err)
+	}
+	logger.Warning.Printf("permanently added %s key with fingerprint %s for host %s to known hosts file %s",
+		key.Type(), ssh.FingerprintSHA256(key), hostname, k.userFile)
+	return nil
+}
@@ -0,0 +1,212 @@
+package ssh
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path"
+	"testing"
+
+	"github.com/BlaineEXE/octopus/internal/remote"
+	"github.com/BlaineEXE/octopus/internal/util/testutil"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func newTestPublicKey(t *testing.T) ssh.PublicKey {
+	s, _ := newTestSigner(t)
+	return s.PublicKey()
+}
+
+func newTestED25519Signer(t *testing.T) ssh.Signer {
+	_, k, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate test key. %+v", err)
+	}
+	s, err := ssh.NewSignerFromKey(k)
+	if err != nil {
+		t.Fatalf("failed to create test signer. %+v", err)
+	}
+	return s
+}
+
+func Test_hostKeyChecker_check(t *testing.T) {
+	tmpRoot, cleanup := testutil.TempDir("")
+	defer cleanup()
+
+	runtimeUserKnownHostsFile, runtimeGlobalKnownHostsFile := userKnownHostsFile, globalKnownHostsFile
+	defer func() {
+		userKnownHostsFile, globalKnownHostsFile = runtimeUserKnownHostsFile, runtimeGlobalKnownHostsFile
+	}()
+	globalKnownHostsFile = path.Join(tmpRoot, "does-not-exist")
+
+	knownKey := newTestPublicKey(t)
+	otherKey := newTestPublicKey(t)
+	otherTypeKey := newTestED25519Signer(t).PublicKey()
+	extraFile := path.Join(tmpRoot, "extra_known_hosts")
+	testutil.WriteFile(extraFile, knownhosts.Line([]string{"1.1.1.1:22"}, knownKey)+"\n"+
+		knownhosts.Line([]string{"3.3.3.3:22"}, otherTypeKey)+"\n", 0644)
+
+	remoteAddr := &net.TCPAddr{IP: net.ParseIP("1.1.1.1"), Port: 22}
+	newAddr := &net.TCPAddr{IP: net.ParseIP("2.2.2.2"), Port: 22}
+	otherTypeAddr := &net.TCPAddr{IP: net.ParseIP("3.3.3.3"), Port: 22}
+
+	tests := []struct {
+		name         string
+		mode         string
+		hostname     string
+		remote       net.Addr
+		key          ssh.PublicKey
+		wantErr      bool
+		wantAccepted bool // whether the key should be written to the user known hosts file
+	}{
+		{"strict, known", StrictHostKeyChecking, "1.1.1.1:22", remoteAddr, knownKey, false, false},
+		{"strict, mismatch", StrictHostKeyChecking, "1.1.1.1:22", remoteAddr, otherKey, true, false},
+		{"strict, mismatch same type", StrictHostKeyChecking, "3.3.3.3:22", otherTypeAddr,
+			newTestED25519Signer(t).PublicKey(), true, false},
+		{"strict, unknown", StrictHostKeyChecking, "2.2.2.2:22", newAddr, otherKey, true, false},
+		{"accept-new, known", AcceptNewHostKeyChecking, "1.1.1.1:22", remoteAddr, knownKey, false, false},
+		{"accept-new, mismatch", AcceptNewHostKeyChecking, "1.1.1.1:22", remoteAddr, otherKey, true, false},
+		{"accept-new, unknown", AcceptNewHostKeyChecking, "2.2.2.2:22", newAddr, otherKey, false, true},
+		// only a key of another type is known for the host
+		{"strict, unknown type", StrictHostKeyChecking, "3.3.3.3:22", otherTypeAddr, otherKey, true, false},
+		{"accept-new, unknown type", AcceptNewHostKeyChecking, "3.3.3.3:22", otherTypeAddr, otherKey, false, true},
+		{"off, mismatch", NoHostKeyChecking, "1.1.1.1:22", remoteAddr, otherKey, false, false},
+		{"off, unknown", NoHostKeyChecking, "2.2.2.2:22", newAddr, otherKey, false, false},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userKnownHostsFile = path.Join(tmpRoot, fmt.Sprintf("user_known_hosts_%d", i))
+
+			k, err := newHostKeyChecker(tt.mode, []string{extraFile})
+			assert.NoError(t, err)
+			err = k.check(tt.hostname, tt.remote, tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("hostKeyChecker.check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				// the user should be able to identify the offending key
+				assert.Contains(t, err.Error(), ssh.FingerprintSHA256(tt.key))
+			}
+
+			b, _ := ioutil.ReadFile(userKnownHostsFile)
+			if tt.wantAccepted {
+				assert.Equal(t, knownhosts.Line([]string{tt.hostname}, tt.key)+"\n", string(b))
+				// a second check should succeed without adding the key again
+				assert.NoError(t, k.check(tt.hostname, tt.remote, tt.key))
+				b, _ = ioutil.ReadFile(userKnownHostsFile)
+				assert.Equal(t, knownhosts.Line([]string{tt.hostname}, tt.key)+"\n", string(b))
+			} else {
+				assert.Empty(t, string(b))
+			}
+		})
+	}
+
+	_, err := newHostKeyChecker("yes", []string{})
+	assert.Error(t, err)
+}
+
+func Test_hostKeyChecker_algorithms(t *testing.T) {
+	tmpRoot, cleanup := testutil.TempDir("")
+	defer cleanup()
+
+	runtimeUserKnownHostsFile, runtimeGlobalKnownHostsFile := userKnownHostsFile, globalKnownHostsFile
+	defer func() {
+		userKnownHostsFile, globalKnownHostsFile = runtimeUserKnownHostsFile, runtimeGlobalKnownHostsFile
+	}()
+	userKnownHostsFile = path.Join(tmpRoot, "user_known_hosts")
+	globalKnownHostsFile = path.Join(tmpRoot, "does-not-exist")
+
+	extraFile := path.Join(tmpRoot, "extra_known_hosts")
+	testutil.WriteFile(extraFile,
+		knownhosts.Line([]string{"1.1.1.1:22"}, newTestED25519Signer(t).PublicKey())+"\n"+
+			knownhosts.Line([]string{"2.2.2.2:22"}, newTestED25519Signer(t).PublicKey())+"\n"+
+			knownhosts.Line([]string{"2.2.2.2:22"}, newTestPublicKey(t))+"\n", 0644)
+
+	tests := []struct {
+		name      string
+		mode      string
+		hostname  string
+		wantFirst []string // nil if the defaults should be used
+	}{
+		{"one known type", AcceptNewHostKeyChecking, "1.1.1.1:22", []string{ssh.KeyAlgoED25519}},
+		{"known types in default order", StrictHostKeyChecking, "2.2.2.2:22",
+			[]string{ssh.KeyAlgoECDSA256, ssh.KeyAlgoED25519}},
+		{"unknown host", AcceptNewHostKeyChecking, "3.3.3.3:22", nil},
+		{"off", NoHostKeyChecking, "1.1.1.1:22", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := newHostKeyChecker(tt.mode, []string{extraFile})
+			assert.NoError(t, err)
+			got := k.algorithms(tt.hostname)
+			if tt.wantFirst == nil {
+				assert.Nil(t, got)
+				return
+			}
+			// other algorithms are still offered after the known ones
+			assert.Equal(t, tt.wantFirst, got[:len(tt.wantFirst)])
+			assert.ElementsMatch(t, defaultHostKeyAlgorithms, got)
+		})
+	}
+}
+
+func TestConnector_Connect_knownKeyType(t *testing.T) {
+	tmpRoot, cleanup := testutil.TempDir("")
+	defer cleanup()
+
+	runtimeUserKnownHostsFile, runtimeGlobalKnownHostsFile := userKnownHostsFile, globalKnownHostsFile
+	defer func() {
+		userKnownHostsFile, globalKnownHostsFile = runtimeUserKnownHostsFile, runtimeGlobalKnownHostsFile
+	}()
+	userKnownHostsFile = path.Join(tmpRoot, "user_known_hosts")
+	globalKnownHostsFile = path.Join(tmpRoot, "does-not-exist")
+
+	// the host has an ECDSA key, which the ssh package prefers, and an ed25519 key
+	ecdsaSigner, _ := newTestSigner(t)
+	ed25519Signer := newTestED25519Signer(t)
+	serverConfig := &ssh.ServerConfig{NoClientAuth: true}
+	serverConfig.AddHostKey(ecdsaSigner)
+	serverConfig.AddHostKey(ed25519Signer)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen. %+v", err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				if _, chans, reqs, err := ssh.NewServerConn(conn, serverConfig); err == nil {
+					go ssh.DiscardRequests(reqs)
+					for range chans {
+					}
+				}
+				conn.Close()
+			}()
+		}
+	}()
+	addr := l.Addr().(*net.TCPAddr)
+
+	// only the ed25519 key is known, as when OpenSSH has recorded it
+	extraFile := path.Join(tmpRoot, "extra_known_hosts")
+	testutil.WriteFile(extraFile, knownhosts.Line([]string{l.Addr().String()}, ed25519Signer.PublicKey())+"\n", 0644)
+
+	c := NewConnector()
+	assert.NoError(t, c.SSHConfigFile("none"))
+	assert.NoError(t, c.HostKeyChecking(StrictHostKeyChecking, []string{extraFile}))
+	s, _ := newTestSigner(t)
+	c.signers = append(c.signers, s)
+
+	a, err := c.Connect(context.Background(), remote.Host{Address: "127.0.0.1", Port: uint16(addr.Port)})
+	if assert.NoError(t, err) {
+		a.Close()
+	}
+}
@@ -0,0 +1,229 @@
+package ssh
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BlaineEXE/octopus/internal/logger"
+	"github.com/BlaineEXE/octopus/internal/remote"
+	"golang.org/x/crypto/ssh"
+)
+
+// A bastion is a connection to a jump host which is shared by all hosts which are connected to
+// through it. Hosts which need the jump host while it is being connected to wait for and share the
+// result, but only a successful connection is kept; the next host to need it after a failure tries
+// connecting again. A kept connection which is found to be lost is forgotten the same way.
+type bastion struct {
+	lock    sync.Mutex
+	client  *ssh.Client
+	dialing *bastionDial // the connection attempt in progress, if any
+}
+
+type bastionDial struct {
+	done   chan struct{}
+	client *ssh.Client
+	err    error
+}
+
+// JumpHosts sets the jump hosts (bastions) through which connections to hosts will be tunneled, in
+// the order given. Jump hosts are of the form [user@]host[:port]. Jump hosts set here take
+// precedence over jump hosts set with ProxyJump in the ssh config file. IPv6 addresses with a port
+// must be surrounded by square brackets. Setting an empty list uses
+// the ssh config file's ProxyJump settings.
+func (c *Connector) JumpHosts(hosts []string) error {
+	for _, h := range hosts {
+		if _, err := remote.ParseHost(h); err != nil {
+			return fmt.Errorf("invalid jump host. %+v", err)
+		}
+	}
+	c.jumpHosts = hosts
+	return nil
+}
+
+// return the ssh config's ProxyJump hosts for a host; the value "none" means no jump hosts
+func proxyJumpHosts(conf *sshConfig, host string) []string {
+	v := conf.get(host, "proxyjump")
+	if v == "" || strings.ToLower(v) == "none" {
+		return []string{}
+	}
+	hosts := []string{}
+	for _, h := range strings.Split(v, ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			hosts = append(hosts, h)
+		}
+	}
+	return hosts
+}
+
+// bastion returns the client connected to the last jump host in the chain, which is itself
+// connected to through the jump hosts before it in the chain.
+func (c *Connector) bastion(chain []string) (*ssh.Client, error) {
+	key := strings.Join(chain, ",")
+	c.bastionsLock.Lock()
+	b, ok := c.bastions[key]
+	if !ok {
+		b = &bastion{}
+		c.bastions[key] = b
+	}
+	c.bastionsLock.Unlock()
+
+	b.lock.Lock()
+	if b.client != nil {
+		b.lock.Unlock()
+		return b.client, nil
+	}
+	d := b.dialing
+	if d != nil {
+		b.lock.Unlock()
+		<-d.done
+		return d.client, d.err
+	}
+	d = &bastionDial{done: make(chan struct{})}
+	b.dialing = d
+	b.lock.Unlock()
+
+	d.client, d.err = c.dialBastion(chain)
+
+	b.lock.Lock()
+	b.dialing = nil
+	if d.err == nil {
+		b.client = d.client
+	}
+	b.lock.Unlock()
+	close(d.done)
+	return d.client, d.err
+}
+
+// forget the client connected to the last jump host in the chain if it is still the one kept
+func (c *Connector) forgetBastion(chain []string, client *ssh.Client) {
+	c.bastionsLock.Lock()
+	b, ok := c.bastions[strings.Join(chain, ",")]
+	c.bastionsLock.Unlock()
+	if !ok {
+		return
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.client == client {
+		b.client = nil
+		client.Close()
+	}
+}
+
+// connect to the last jump host in the chain through the jump hosts before it
+func (c *Connector) dialBastion(chain []string) (*ssh.Client, error) {
+	jumpHost := chain[len(chain)-1]
+	h, err := remote.ParseHost(jumpHost)
+	if err != nil {
+		return nil, err
+	}
+	// Octopus's explicit user and port are for target hosts, not for jump hosts.
+	s, err := c.resolve(h.Address, h.User, h.Port)
+	if err != nil {
+		return nil, err
+	}
+	// A jump host is only connected to through the jump hosts before it in the chain, so its own
+	// ProxyJump setting in the ssh config can't also be followed.
+	before := chain[:len(chain)-1]
+	if len(s.jumpHosts) > 0 && strings.Join(s.jumpHosts, ",") != strings.Join(before, ",") {
+		logger.Warning.Printf("ignoring ProxyJump %s set in the ssh config for jump host %s; "+
+			"give all jump hosts in order with --jump or ProxyJump for the target hosts instead",
+			strings.Join(s.jumpHosts, ","), jumpHost)
+	}
+	s.jumpHosts = before
+	logger.Info.Println("connecting to jump host:", jumpHost)
+	client, err := c.dial(s)
+	switch e := err.(type) {
+	case nil:
+		return client, nil
+	case *remote.TimeoutError:
+		return nil, &remote.TimeoutError{Operation: "connecting to jump host " + jumpHost, Limit: e.Limit}
+	case *remote.UnreachableError:
+		// hosts behind a jump host which can't be reached can't be reached either
+		return nil, &remote.UnreachableError{
+			Err: fmt.Errorf("failed to connect to jump host %s. %+v", jumpHost, e.Err)}
+	}
+	return nil, fmt.Errorf("failed to connect to jump host %s. %+v", jumpHost, err)
+}
+
+// dial a host directly, or through its jump hosts if it has any. Connecting must finish within the
+// host's connect timeout. The host's identity files are read before the timeout begins.
+func (c *Connector) dial(s *hostSettings) (*ssh.Client, error) {
+	addr := net.JoinHostPort(s.hostName, strconv.Itoa(int(s.port)))
+	conf := c.clientConfigFor(s, c.hostSigners(s.identityFiles))
+	if len(s.jumpHosts) == 0 {
+		return dialHost("tcp", addr, conf)
+	}
+
+	conn, err := c.tunnel(s.jumpHosts, addr, s.connectTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return newClientConn(conn, addr, conf)
+}
+
+// Tunnel to the address through the last jump host in the chain. The jump host reports when it
+// can't reach the address, so any other failure means that the connection to the jump host has
+// been lost, and the jump host is connected to again once. An address which the jump host can't
+// reach in time is unreachable.
+func (c *Connector) tunnel(chain []string, addr string, timeout time.Duration) (net.Conn, error) {
+	jumpHost := chain[len(chain)-1]
+	for retried := false; ; retried = true {
+		b, err := c.bastion(chain)
+		if err != nil {
+			return nil, err
+		}
+		conn, err := dialWithTimeout(func() (net.Conn, error) { return b.Dial("tcp", addr) },
+			addr, timeout)
+		if err == nil {
+			return conn, nil
+		}
+		if _, ok := err.(*remote.TimeoutError); ok {
+			return nil, &remote.UnreachableError{Err: err}
+		}
+		if _, ok := err.(*ssh.OpenChannelError); ok {
+			return nil, &remote.UnreachableError{
+				Err: fmt.Errorf("failed to tunnel to %s through jump host %s. %+v", addr, jumpHost, err)}
+		}
+		if retried {
+			return nil, fmt.Errorf("failed to tunnel to %s through jump host %s. %+v", addr, jumpHost, err)
+		}
+		logger.Info.Printf("lost connection to jump host %s; connecting again. %+v", jumpHost, err)
+		c.forgetBastion(chain, b)
+	}
+}
+
+// The jump host may take a long time to report that it could not reach a black-holed host, so
+// stop waiting for it after the timeout. A connection made after that is closed.
+func dialWithTimeout(dial func() (net.Conn, error), addr string, timeout time.Duration) (net.Conn, error) {
+	if timeout <= 0 {
+		return dial()
+	}
+	type dialResult struct {
+		conn net.Conn
+		err  error
+	}
+	ch := make(chan dialResult, 1)
+	go func() {
+		conn, err := dial()
+		ch <- dialResult{conn, err}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case r := <-ch:
+		return r.conn, r.err
+	case <-timer.C:
+		go func() {
+			if r := <-ch; r.conn != nil {
+				r.conn.Close()
+			}
+		}()
+		return nil, &remote.TimeoutError{Operation: "connecting to " + addr, Limit: timeout}
+	}
+}
@@ -0,0 +1,192 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/BlaineEXE/octopus/internal/logger"
+	"github.com/BlaineEXE/octopus/internal/remote"
+	"github.com/BlaineEXE/octopus/internal/util/testutil"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+func Test_proxyJumpHosts(t *testing.T) {
+	conf, err := parseSSHConfig(strings.NewReader(`
+Host a
+  ProxyJump none
+Host b
+  ProxyJump jump1, jump@jump2:2222
+Host *
+  ProxyJump default
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{}, proxyJumpHosts(conf, "a"))
+	assert.Equal(t, []string{"jump1", "jump@jump2:2222"}, proxyJumpHosts(conf, "b"))
+	assert.Equal(t, []string{"default"}, proxyJumpHosts(conf, "c"))
+}
+
+func TestConnector_bastionShared(t *testing.T) {
+	runtimeDialHost := dialHost
+	defer func() { dialHost = runtimeDialHost }()
+	dials := []string{}
+	dialHost = func(network, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+		dials = append(dials, config.User+"@"+addr)
+		return nil, fmt.Errorf("test dial error")
+	}
+
+	c := NewConnector()
+	assert.NoError(t, c.SSHConfigFile("none"))
+	assert.NoError(t, c.User("admin"))
+	assert.NoError(t, c.JumpHosts([]string{"jump@bastion:2222"}))
+	assert.Error(t, c.JumpHosts([]string{"bastion:bad"}))
+	s, _ := newTestSigner(t)
+	c.signers = append(c.signers, s)
+
+	for _, host := range []remote.Host{{Address: "node-1"}, {Address: "node-2"}} {
+		_, err := c.Connect(context.Background(), host)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "jump host jump@bastion:2222")
+	}
+	// the jump host is connected to with its own user, and a failed connection is tried again
+	assert.Equal(t, []string{"jump@bastion:2222", "jump@bastion:2222"}, dials)
+}
+
+func TestConnector_bastion(t *testing.T) {
+	runtimeDialHost := dialHost
+	defer func() { dialHost = runtimeDialHost }()
+	client := &ssh.Client{}
+	dials := 0
+	dialHost = func(network, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+		dials++
+		if dials == 1 {
+			return nil, fmt.Errorf("test dial error")
+		}
+		return client, nil
+	}
+
+	c := NewConnector()
+	assert.NoError(t, c.SSHConfigFile("none"))
+	s, _ := newTestSigner(t)
+	c.signers = append(c.signers, s)
+
+	// a failure is not kept
+	_, err := c.bastion([]string{"bastion"})
+	assert.Error(t, err)
+	got, err := c.bastion([]string{"bastion"})
+	assert.NoError(t, err)
+	assert.Equal(t, client, got)
+	// a successful connection is kept
+	got, err = c.bastion([]string{"bastion"})
+	assert.NoError(t, err)
+	assert.Equal(t, client, got)
+	assert.Equal(t, 2, dials)
+}
+
+func TestConnector_bastion_proxyJump(t *testing.T) {
+	tmpRoot, cleanup := testutil.TempDir("")
+	defer cleanup()
+
+	runtimeDialHost, runtimeWarning := dialHost, logger.Warning
+	defer func() { dialHost, logger.Warning = runtimeDialHost, runtimeWarning }()
+	dials := []string{}
+	dialHost = func(network, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+		dials = append(dials, addr)
+		return nil, fmt.Errorf("test dial error")
+	}
+	warnings := &bytes.Buffer{}
+	logger.Warning = log.New(warnings, "", 0)
+
+	sshConfigFile := path.Join(tmpRoot, "ssh_config")
+	testutil.WriteFile(sshConfigFile, "Host bastion\n  ProxyJump outer\n", 0644)
+	c := NewConnector()
+	assert.NoError(t, c.SSHConfigFile(sshConfigFile))
+	assert.NoError(t, c.JumpHosts([]string{"bastion"}))
+	s, _ := newTestSigner(t)
+	c.signers = append(c.signers, s)
+
+	_, err := c.Connect(context.Background(), remote.Host{Address: "node-1"})
+	assert.Error(t, err)
+	// the jump host's own ProxyJump is not followed, and the user is told so
+	assert.Equal(t, []string{"bastion:22"}, dials)
+	assert.Contains(t, warnings.String(),
+		"ignoring ProxyJump outer set in the ssh config for jump host bastion")
+
+	// ProxyJump which matches the jump hosts before the jump host is not warned about
+	warnings.Reset()
+	assert.NoError(t, c.JumpHosts([]string{"outer", "bastion"}))
+	_, err = c.Connect(context.Background(), remote.Host{Address: "node-1"})
+	assert.Error(t, err)
+	assert.Empty(t, warnings.String())
+}
+
+func TestConnector_tunnel_lostBastion(t *testing.T) {
+	// the jump host drops the first connection to it right away, and it can't reach any hosts
+	hostKey, _ := newTestSigner(t)
+	serverConfig := &ssh.ServerConfig{NoClientAuth: true}
+	serverConfig.AddHostKey(hostKey)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen. %+v", err)
+	}
+	defer l.Close()
+	go func() {
+		for n := 0; ; n++ {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(drop bool) {
+				defer conn.Close()
+				_, chans, reqs, err := ssh.NewServerConn(conn, serverConfig)
+				if err != nil || drop {
+					return
+				}
+				go ssh.DiscardRequests(reqs)
+				for ch := range chans {
+					ch.Reject(ssh.ConnectionFailed, "no route to host")
+				}
+			}(n == 0)
+		}
+	}()
+
+	runtimeDialHost := dialHost
+	defer func() { dialHost = runtimeDialHost }()
+	dials := 0
+	dialHost = func(network, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+		dials++
+		return ssh.Dial(network, l.Addr().String(), config)
+	}
+
+	c := NewConnector()
+	assert.NoError(t, c.SSHConfigFile("none"))
+	assert.NoError(t, c.HostKeyChecking(NoHostKeyChecking, []string{}))
+	assert.NoError(t, c.JumpHosts([]string{"bastion"}))
+	s, _ := newTestSigner(t)
+	c.signers = append(c.signers, s)
+
+	lost, err := c.bastion([]string{"bastion"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	lost.Wait()
+
+	// the lost connection is replaced, and the jump host's own failure to reach the host is reported
+	_, err = c.Connect(context.Background(), remote.Host{Address: "node-1"})
+	assert.Error(t, err)
+	assert.IsType(t, &remote.UnreachableError{}, err)
+	assert.Contains(t, err.Error(), "failed to tunnel to node-1:22 through jump host bastion")
+	assert.Contains(t, err.Error(), "no route to host")
+	assert.Equal(t, 2, dials)
+
+	// the new connection is kept
+	_, err = c.Connect(context.Background(), remote.Host{Address: "node-2"})
+	assert.Error(t, err)
+	assert.Equal(t, 2, dials)
+}
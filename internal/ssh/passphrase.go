@@ -0,0 +1,34 @@
+package ssh
+
+import (
+	"fmt"
+
+	"github.com/BlaineEXE/octopus/internal/logger"
+	"github.com/BlaineEXE/octopus/internal/util"
+	"golang.org/x/crypto/ssh"
+)
+
+// PassphraseEnvVar is the environment variable from which the passphrase for encrypted identity
+// files is read. If it is not set, the user is prompted for the passphrase on the terminal, or, if
+// there is no terminal, the passphrase is read from the program set in SSH_ASKPASS.
+const PassphraseEnvVar = "OCTOPUS_PASSPHRASE"
+
+// parse a private key, getting the passphrase from the user if the key is encrypted
+func parsePrivateKey(filePath string, key []byte) (ssh.Signer, error) {
+	signer, err := ssh.ParsePrivateKey(key)
+	if _, ok := err.(*ssh.PassphraseMissingError); !ok {
+		return signer, err
+	}
+
+	logger.Info.Println("identity file is encrypted:", filePath)
+	passphrase, err := readPassphrase(fmt.Sprintf("Enter passphrase for key '%s': ", filePath))
+	if err != nil {
+		return nil, fmt.Errorf("unable to get passphrase for encrypted key. %+v", err)
+	}
+	return ssh.ParsePrivateKeyWithPassphrase(key, passphrase)
+}
+
+// Allow this to be overridden for tests.
+var readPassphrase = func(prompt string) ([]byte, error) {
+	return util.ReadSecret(PassphraseEnvVar, prompt)
+}
@@ -0,0 +1,225 @@
+package ssh
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/BlaineEXE/octopus/internal/logger"
+	"github.com/BlaineEXE/octopus/internal/util"
+)
+
+var (
+	// per-host settings are read from the user's config first and then from the global config
+	userSSHConfigFile   = "~/.ssh/config"
+	globalSSHConfigFile = "/etc/ssh/ssh_config"
+)
+
+// An sshConfig is a parsed OpenSSH client config file (see ssh_config(5)). Only the settings
+// Octopus uses are interpreted. 'Match' blocks are not supported, and their settings are ignored.
+type sshConfig struct {
+	blocks []*sshConfigBlock // in the order they appear in the config file(s)
+}
+
+// a 'Host' block, with its patterns and the settings within it
+type sshConfigBlock struct {
+	patterns []string // negated patterns begin with '!'; a nil pattern list never matches
+	settings []sshConfigSetting
+}
+
+type sshConfigSetting struct {
+	keyword string // lowercase; keywords are case insensitive
+	value   string
+}
+
+// loadSSHConfig reads and parses the config files in order. Files which do not exist are skipped.
+func loadSSHConfig(files ...string) (*sshConfig, error) {
+	c := &sshConfig{blocks: []*sshConfigBlock{}}
+	for _, f := range files {
+		p, err := util.AbsPath(f)
+		if err != nil {
+			return nil, err
+		}
+		r, err := os.Open(p)
+		if err != nil {
+			if os.IsNotExist(err) {
+				logger.Info.Println("ssh config file does not exist:", p)
+				continue
+			}
+			return nil, fmt.Errorf("could not read ssh config file %s. %+v", p, err)
+		}
+		logger.Info.Println("reading ssh config file:", p)
+		fc, err := parseSSHConfig(r)
+		r.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse ssh config file %s. %+v", p, err)
+		}
+		c.blocks = append(c.blocks, fc.blocks...)
+	}
+	return c, nil
+}
+
+func parseSSHConfig(r io.Reader) (*sshConfig, error) {
+	// settings before the first 'Host' line apply to all hosts
+	block := &sshConfigBlock{patterns: []string{"*"}}
+	c := &sshConfig{blocks: []*sshConfigBlock{block}}
+
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		keyword, args, err := splitSSHConfigLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %+v", lineNum, err)
+		}
+		switch keyword {
+		case "host":
+			block = &sshConfigBlock{patterns: args}
+			c.blocks = append(c.blocks, block)
+		case "match":
+			logger.Info.Println("ssh config 'Match' is not supported; ignoring settings on line", lineNum)
+			block = &sshConfigBlock{patterns: nil}
+			c.blocks = append(c.blocks, block)
+		case "include":
+			logger.Info.Println("ssh config 'Include' is not supported; ignoring line", lineNum)
+		default:
+			block.settings = append(block.settings, sshConfigSetting{keyword, strings.Join(args, " ")})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// split a config line into its lowercase keyword and its arguments. The keyword may be separated
+// from its arguments by whitespace or by an optional equal sign, and arguments may be quoted.
+func splitSSHConfigLine(line string) (keyword string, args []string, err error) {
+	i := strings.IndexAny(line, " \t=")
+	if i < 0 {
+		return "", nil, fmt.Errorf("keyword %q has no value", line)
+	}
+	keyword = strings.ToLower(line[:i])
+	rest := strings.TrimLeft(line[i:], " \t")
+	if strings.HasPrefix(rest, "=") {
+		rest = strings.TrimLeft(rest[1:], " \t")
+	}
+
+	args = []string{}
+	for rest != "" {
+		var arg string
+		if rest[0] == '"' {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				return "", nil, fmt.Errorf("unterminated quote in %q", line)
+			}
+			arg, rest = rest[1:end+1], rest[end+2:]
+		} else if end := strings.IndexAny(rest, " \t"); end >= 0 {
+			arg, rest = rest[:end], rest[end:]
+		} else {
+			arg, rest = rest, ""
+		}
+		args = append(args, arg)
+		rest = strings.TrimLeft(rest, " \t")
+	}
+	if len(args) == 0 {
+		return "", nil, fmt.Errorf("keyword %q has no value", keyword)
+	}
+	return keyword, args, nil
+}
+
+// get returns the value of the first setting for the keyword which applies to the host. As with
+// OpenSSH, the first value obtained for a setting is the one used. Returns "" if it isn't set.
+func (c *sshConfig) get(host, keyword string) string {
+	v := c.getAll(host, keyword)
+	if len(v) == 0 {
+		return ""
+	}
+	return v[0]
+}
+
+// getAll returns the values of all settings for the keyword which apply to the host, in order.
+// This is for settings like 'IdentityFile' which may be given more than once.
+func (c *sshConfig) getAll(host, keyword string) []string {
+	values := []string{}
+	for _, b := range c.blocks {
+		if !b.matches(host) {
+			continue
+		}
+		for _, s := range b.settings {
+			if s.keyword == keyword {
+				values = append(values, s.value)
+			}
+		}
+	}
+	return values
+}
+
+// a block matches a host if any of its patterns match the host and none of its negated patterns do
+func (b *sshConfigBlock) matches(host string) bool {
+	host = strings.ToLower(host)
+	matched := false
+	for _, p := range b.patterns {
+		p = strings.ToLower(p)
+		if strings.HasPrefix(p, "!") {
+			if wildcardMatch(p[1:], host) {
+				return false
+			}
+			continue
+		}
+		if wildcardMatch(p, host) {
+			matched = true
+		}
+	}
+	return matched
+}
+
+// match a string against a pattern where '*' matches zero or more characters and '?' matches
+// exactly one character
+func wildcardMatch(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(s); i >= 0; i-- {
+				if wildcardMatch(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+		default:
+			if len(s) == 0 || pattern[0] != s[0] {
+				return false
+			}
+		}
+		pattern, s = pattern[1:], s[1:]
+	}
+	return len(s) == 0
+}
+
+// expand the OpenSSH tokens Octopus supports in config values
+//   %% - a literal '%'
+//   %d - the local user's home dir
+//   %h - the remote host name
+//   %p - the remote port
+//   %r - the remote user name
+//   %u - the local user name
+func expandSSHConfigTokens(value, host, port, remoteUser string) string {
+	if !strings.Contains(value, "%") {
+		return value
+	}
+	home, _ := util.AbsPath("~")
+	localUser := os.Getenv("USER")
+	r := strings.NewReplacer("%%", "%", "%d", home, "%h", host, "%p", port, "%r", remoteUser, "%u", localUser)
+	return r.Replace(value)
+}
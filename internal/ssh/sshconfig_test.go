@@ -0,0 +1,154 @@
+package ssh
+
+import (
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BlaineEXE/octopus/internal/util/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+const testSSHConfig = `
+# global settings come first
+ConnectTimeout 10
+
+Host bastion
+  HostName 192.168.1.1
+  User jump
+  Port=2222
+
+Host node-? !node-9
+  User admin
+  IdentityFile ~/.ssh/node_key
+  IdentityFile "/keys/with space"
+
+Match host node-1
+  User ignored
+
+Host node-*
+  HostName %h.cluster.local
+  ProxyJump bastion
+  User fallback
+  Port 3022
+  ConnectTimeout 5
+
+Host *
+  IdentityFile /keys/default
+  ProxyJump none
+`
+
+func Test_sshConfig_get(t *testing.T) {
+	c, err := parseSSHConfig(strings.NewReader(testSSHConfig))
+	assert.NoError(t, err)
+
+	tests := []struct {
+		host    string
+		keyword string
+		want    []string
+	}{
+		{"bastion", "hostname", []string{"192.168.1.1"}},
+		{"bastion", "user", []string{"jump"}},
+		{"bastion", "port", []string{"2222"}},
+		{"bastion", "connecttimeout", []string{"10"}},
+		{"bastion", "identityfile", []string{"/keys/default"}},
+		{"node-1", "user", []string{"admin", "fallback"}},
+		{"NODE-1", "user", []string{"admin", "fallback"}},
+		{"node-1", "identityfile", []string{"~/.ssh/node_key", "/keys/with space", "/keys/default"}},
+		{"node-1", "hostname", []string{"%h.cluster.local"}},
+		{"node-1", "connecttimeout", []string{"10", "5"}},
+		{"node-9", "user", []string{"fallback"}},
+		{"node-10", "user", []string{"fallback"}},
+		{"other", "user", []string{}},
+		{"other", "port", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host+" "+tt.keyword, func(t *testing.T) {
+			assert.Equal(t, tt.want, c.getAll(tt.host, tt.keyword))
+			want := ""
+			if len(tt.want) > 0 {
+				want = tt.want[0]
+			}
+			assert.Equal(t, want, c.get(tt.host, tt.keyword))
+		})
+	}
+}
+
+func Test_parseSSHConfig_errors(t *testing.T) {
+	for _, conf := range []string{
+		"User",
+		"Host",
+		`IdentityFile "/unterminated`,
+	} {
+		_, err := parseSSHConfig(strings.NewReader(conf))
+		assert.Error(t, err, conf)
+	}
+}
+
+func Test_wildcardMatch(t *testing.T) {
+	tests := []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"*", "", true},
+		{"*", "anything", true},
+		{"node-?", "node-1", true},
+		{"node-?", "node-10", false},
+		{"node-*", "node-10", true},
+		{"*.local", "a.b.local", true},
+		{"*.local", "a.b.locals", false},
+		{"10.0.*.1", "10.0.25.1", true},
+		{"exact", "exact", true},
+		{"exact", "exactly", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, wildcardMatch(tt.pattern, tt.s), "%s matching %s", tt.pattern, tt.s)
+	}
+}
+
+func TestConnector_resolve(t *testing.T) {
+	tmpRoot, cleanup := testutil.TempDir("")
+	defer cleanup()
+	configFile := path.Join(tmpRoot, "config")
+	testutil.WriteFile(configFile, testSSHConfig, 0644)
+
+	tests := []struct {
+		name     string
+		host     string
+		user     string // explicitly set user
+		port     uint16 // explicitly set port
+		noConfig bool
+		want     hostSettings
+	}{
+		{"defaults without config", "node-1", "", 0, true,
+			hostSettings{"node-1", 22, "root", []string{}, defaultConnectTimeout, []string{}}},
+		{"explicit values without config", "node-1", "me", 2022, true,
+			hostSettings{"node-1", 2022, "me", []string{}, defaultConnectTimeout, []string{}}},
+		{"values from config", "node-1", "", 0, false,
+			hostSettings{"node-1.cluster.local", 3022, "admin",
+				[]string{"/keys/with space", "/keys/default"}, 10 * time.Second, []string{"bastion"}}},
+		{"explicit values override config", "bastion", "me", 2022, false,
+			hostSettings{"192.168.1.1", 2022, "me", []string{"/keys/default"}, 10 * time.Second, []string{}}},
+		{"host not in config", "other", "", 0, false,
+			hostSettings{"other", 22, "root", []string{"/keys/default"}, 10 * time.Second, []string{}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewConnector()
+			if tt.noConfig {
+				assert.NoError(t, c.SSHConfigFile("none"))
+			} else {
+				assert.NoError(t, c.SSHConfigFile(configFile))
+			}
+			got, err := c.resolve(tt.host, tt.user, tt.port)
+			assert.NoError(t, err)
+			if tt.name == "values from config" {
+				// ~ is expanded to the home dir, which differs between test systems
+				assert.True(t, strings.HasSuffix(got.identityFiles[0], "/.ssh/node_key"))
+				got.identityFiles = got.identityFiles[1:]
+			}
+			assert.Equal(t, tt.want, *got)
+		})
+	}
+}
@@ -44,7 +44,7 @@ func FileCopier(
 	remoteDestDir string,
 	opts *CopyFileOptions,
 ) remote.Action {
-	return func(a remote.Actor) (stdout, stderr *bytes.Buffer, err error) {
+	return func(a remote.Actor, h *remote.HostInfo) (stdout, stderr *bytes.Buffer, err error) {
 		if err = a.CreateRemoteDir(remoteDestDir, os.FileMode(0644)); err != nil {
 			return
 		}
@@ -6,6 +6,7 @@ import (
 	"path"
 	"testing"
 
+	"github.com/BlaineEXE/octopus/internal/remote"
 	remotetest "github.com/BlaineEXE/octopus/internal/remote/test"
 	"github.com/BlaineEXE/octopus/internal/util/testutil"
 	"github.com/stretchr/testify/assert"
@@ -131,7 +132,7 @@ func TestFileCopier(t *testing.T) {
 			a.FileCopyModes = []os.FileMode{}
 			a.FileCopyFails = []string{}
 			action := FileCopier(tt.args.localSourcePaths, tt.args.remoteDestDir, tt.args.opts)
-			_, e, err := action(a)
+			_, e, err := action(a, &remote.HostInfo{})
 			fmt.Println(e)
 			fmt.Println(err)
 			assert.True(t, (err != nil) == tt.wants.err) //err received when expected
@@ -2,14 +2,189 @@ package tentacle
 
 import (
 	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"text/template/parse"
 
 	"github.com/BlaineEXE/octopus/internal/remote"
 )
 
+// RunCommandOptions is a collection of additional options for how commands are run on remote hosts.
+type RunCommandOptions struct {
+	template bool // the command is a Go text/template rendered for each host
+	dryRun   bool // output the command which would be run on each host instead of running it
+}
+
+// NewRunCommandOptions creates a new option struct for defining how commands are to be run.
+// Create new options in a function instead of relying on a struct so developers are less likely to
+// leave a newly created option unset.
+func NewRunCommandOptions(template, dryRun bool) *RunCommandOptions {
+	return &RunCommandOptions{
+		template: template,
+		dryRun:   dryRun,
+	}
+}
+
 // CommandRunner returns a new remote action definition which defines how actions are to be run
-// on an actor's remote host.
-func CommandRunner(command string) remote.Action {
-	return func(a remote.Actor) (stdout, stderr *bytes.Buffer, err error) {
-		return a.RunCommand(command)
+// on an actor's remote host. If the command is a template, it is rendered for each host with the
+// host's TemplateVars, and an error is returned if the template cannot be parsed. Dry runs don't
+// use the actor, so it may be nil unless NeedsConnection reports that hosts must be connected to.
+func CommandRunner(command string, opts *RunCommandOptions) (remote.Action, error) {
+	var tmpl *template.Template
+	if opts.template {
+		var err error
+		if tmpl, err = parseCommandTemplate(command); err != nil {
+			return nil, err
+		}
+	}
+
+	return func(a remote.Actor, h *remote.HostInfo) (stdout, stderr *bytes.Buffer, err error) {
+		cmd := command
+		if tmpl != nil {
+			b := new(bytes.Buffer)
+			if err = tmpl.Execute(b, newTemplateVars(h)); err != nil {
+				return new(bytes.Buffer), new(bytes.Buffer),
+					fmt.Errorf("failed to render command template. %+v", err)
+			}
+			cmd = b.String()
+		}
+		if opts.dryRun {
+			return bytes.NewBufferString(cmd + "\n"), new(bytes.Buffer), nil
+		}
+		return a.RunCommand(cmd)
+	}, nil
+}
+
+// NeedsConnection returns whether the command runner for the command needs to connect to hosts.
+// Dry runs only connect to hosts if the command is a template which uses the hostname reported by
+// hosts. Otherwise, the actor given to the command runner's action may be nil.
+func NeedsConnection(command string, opts *RunCommandOptions) bool {
+	if !opts.dryRun {
+		return true
 	}
+	if !opts.template {
+		return false
+	}
+	tmpl, err := parseCommandTemplate(command)
+	if err != nil {
+		return false // the error is reported by CommandRunner without needing to connect
+	}
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil && usesHostname(t.Tree.Root) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseCommandTemplate(command string) (*template.Template, error) {
+	// missing attributes are more likely to be typos than intentionally empty
+	tmpl, err := template.New("command").Option("missingkey=error").Parse(command)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse command template. %+v", err)
+	}
+	return tmpl, nil
+}
+
+// whether the template node uses the Name or Hostname variable anywhere within it
+func usesHostname(node parse.Node) bool {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return false
+		}
+		for _, c := range n.Nodes {
+			if usesHostname(c) {
+				return true
+			}
+		}
+	case *parse.ActionNode:
+		return usesHostname(n.Pipe)
+	case *parse.PipeNode:
+		if n == nil {
+			return false
+		}
+		for _, c := range n.Cmds {
+			if usesHostname(c) {
+				return true
+			}
+		}
+	case *parse.CommandNode:
+		for _, a := range n.Args {
+			if usesHostname(a) {
+				return true
+			}
+		}
+	case *parse.IfNode:
+		return usesHostname(n.Pipe) || usesHostname(n.List) || usesHostname(n.ElseList)
+	case *parse.RangeNode:
+		return usesHostname(n.Pipe) || usesHostname(n.List) || usesHostname(n.ElseList)
+	case *parse.WithNode:
+		return usesHostname(n.Pipe) || usesHostname(n.List) || usesHostname(n.ElseList)
+	case *parse.TemplateNode:
+		return usesHostname(n.Pipe)
+	case *parse.ChainNode:
+		return usesHostname(n.Node) || isHostnameField(n.Field)
+	case *parse.FieldNode:
+		return isHostnameField(n.Ident)
+	case *parse.VariableNode:
+		return isHostnameField(n.Ident[1:]) // the first ident is the variable's name
+	}
+	return false
+}
+
+func isHostnameField(idents []string) bool {
+	for _, i := range idents {
+		if i == "Name" || i == "Hostname" {
+			return true
+		}
+	}
+	return false
+}
+
+// TemplateVars are the variables which can be used in command templates, e.g., '{{.Index}}' or
+// '{{.Attrs.rack}}'.
+type TemplateVars struct {
+	Host    string            // the host as given in the host groups file, e.g., admin@10.0.0.5:2222
+	Address string            // the host's address without user or port
+	User    string            // the user given in the host groups file, if any
+	Port    uint16            // the port given in the host groups file, or 0
+	Group   string            // the host group in which the host's entry is
+	Groups  []string          // all of the host groups being operated on which have the host
+	Index   int               // the index of the host's entry within its group, starting from 0
+	Attrs   map[string]string // attributes given in the host's entry as key=value
+
+	hostname func() string
+}
+
+func newTemplateVars(h *remote.HostInfo) *TemplateVars {
+	return &TemplateVars{
+		Host:     h.Host.String(),
+		Address:  h.Host.Address,
+		User:     h.Host.User,
+		Port:     h.Host.Port,
+		Group:    h.Group,
+		Groups:   h.Groups,
+		Index:    h.Index,
+		Attrs:    h.Attrs,
+		hostname: h.Hostname,
+	}
+}
+
+// Name returns the hostname reported by the host. It is an error if the hostname is not known.
+func (v *TemplateVars) Name() (string, error) {
+	n := ""
+	if v.hostname != nil {
+		n = strings.TrimSpace(v.hostname())
+	}
+	if n == "" {
+		return "", fmt.Errorf("could not get hostname of host %s", v.Host)
+	}
+	return n, nil
+}
+
+// Hostname is the same as Name.
+func (v *TemplateVars) Hostname() (string, error) {
+	return v.Name()
 }
@@ -3,6 +3,7 @@ package tentacle
 import (
 	"testing"
 
+	"github.com/BlaineEXE/octopus/internal/remote"
 	remotetest "github.com/BlaineEXE/octopus/internal/remote/test"
 	"github.com/stretchr/testify/assert"
 )
@@ -26,8 +27,9 @@ func TestCommandRunner(t *testing.T) {
 			cmd := tt.args.command
 			a.CommandError = tt.cmdErr
 
-			action := CommandRunner(cmd)
-			o, e, err := action(&a)
+			action, err := CommandRunner(cmd, NewRunCommandOptions(false, false))
+			assert.NoError(t, err)
+			o, e, err := action(&a, &remote.HostInfo{})
 			assert.True(t, (err != nil) == tt.cmdErr) //err received when expected
 
 			run := remotetest.Clear(&a.Commands)
@@ -43,3 +45,102 @@ func TestCommandRunner(t *testing.T) {
 		})
 	}
 }
+
+func TestCommandRunner_template(t *testing.T) {
+	info := &remote.HostInfo{
+		Host:     remote.Host{Address: "10.0.0.5", User: "admin", Port: 2222},
+		Group:    "osds",
+		Index:    3,
+		Groups:   []string{"osds", "all"},
+		Attrs:    map[string]string{"rack": "r1"},
+		Hostname: func() string { return "node3\n" },
+	}
+
+	tests := []struct {
+		name     string
+		template bool
+		command  string
+		want     string
+		wantErr  bool
+	}{
+		{"index", true, "ceph-osd -i {{.Index}}", "ceph-osd -i 3", false},
+		{"name", true, "hostnamectl set-hostname {{.Name}}", "hostnamectl set-hostname node3", false},
+		{"hostname", true, "echo {{.Hostname}}", "echo node3", false},
+		{"host", true, "echo {{.Host}} {{.Address}} {{.User}} {{.Port}}",
+			"echo admin@10.0.0.5:2222 10.0.0.5 admin 2222", false},
+		{"groups", true, "echo {{.Group}} {{range .Groups}}{{.}},{{end}}", "echo osds osds,all,", false},
+		{"attribute", true, "echo {{.Attrs.rack}}", "echo r1", false},
+		{"missing attribute", true, "echo {{.Attrs.row}}", "", true},
+		{"not a template", false, "docker ps --format '{{.Names}}'", "docker ps --format '{{.Names}}'", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &remotetest.MockRemoteActor{}
+			action, err := CommandRunner(tt.command, NewRunCommandOptions(tt.template, false))
+			assert.NoError(t, err)
+			_, _, err = action(a, info)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Len(t, a.Commands, 0)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, []string{tt.want}, a.Commands)
+		})
+	}
+
+	_, err := CommandRunner("echo {{.Index", NewRunCommandOptions(true, false))
+	assert.Error(t, err)
+
+	// the hostname can't be used if it isn't known
+	action, err := CommandRunner("echo {{.Name}}", NewRunCommandOptions(true, false))
+	assert.NoError(t, err)
+	_, _, err = action(&remotetest.MockRemoteActor{},
+		&remote.HostInfo{Hostname: func() string { return "" }})
+	assert.Error(t, err)
+}
+
+func TestCommandRunner_dryRun(t *testing.T) {
+	a := &remotetest.MockRemoteActor{}
+	action, err := CommandRunner("ceph-osd -i {{.Index}}", NewRunCommandOptions(true, true))
+	assert.NoError(t, err)
+	o, e, err := action(a, &remote.HostInfo{Index: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, "ceph-osd -i 2\n", o.String())
+	assert.Equal(t, "", e.String())
+	assert.Len(t, a.Commands, 0)
+
+	// hosts aren't connected to for dry runs which don't need hostnames
+	o, _, err = action(nil, &remote.HostInfo{Index: 3})
+	assert.NoError(t, err)
+	assert.Equal(t, "ceph-osd -i 3\n", o.String())
+}
+
+func TestNeedsConnection(t *testing.T) {
+	tests := []struct {
+		name     string
+		command  string
+		template bool
+		dryRun   bool
+		want     bool
+	}{
+		{"run", "hostname", false, false, true},
+		{"run template", "echo {{.Index}}", true, false, true},
+		{"dry run", "echo {{.Name}}", false, true, false},
+		{"dry run template without hostname", "ceph-osd -i {{.Index}} {{.Attrs.rack}}", true, true, false},
+		{"name", "hostnamectl set-hostname {{.Name}}", true, true, true},
+		{"hostname", "echo {{.Hostname}}", true, true, true},
+		{"in pipeline", `echo {{printf "%s-%d" .Name .Index}}`, true, true, true},
+		{"in if", "{{if .Attrs.osd}}echo{{else}}echo {{.Name}}{{end}}", true, true, true},
+		{"in with", "{{with .Attrs}}echo {{.rack}}{{end}}", true, true, false},
+		{"in range", "{{range .Groups}}{{$.Hostname}}{{end}}", true, true, true},
+		{"variable", "{{$v := .}}{{$v.Name}}", true, true, true},
+		{"defined template", `{{define "n"}}{{.Name}}{{end}}echo {{template "n" .}}`, true, true, true},
+		{"bad template", "echo {{.Name", true, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, NeedsConnection(tt.command, NewRunCommandOptions(tt.template, tt.dryRun)))
+		})
+	}
+}
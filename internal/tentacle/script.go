@@ -0,0 +1,130 @@
+package tentacle
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/BlaineEXE/octopus/internal/remote"
+	"github.com/BlaineEXE/octopus/internal/util"
+)
+
+// RunScriptOptions is a collection of additional options for how scripts are run on remote hosts.
+type RunScriptOptions struct {
+	interpreter string // command with which to run the script; "" means run the script directly
+}
+
+// NewRunScriptOptions creates a new option struct for defining how scripts are to be run.
+// Create new options in a function instead of relying on a struct so developers are less likely to
+// leave a newly created option unset.
+func NewRunScriptOptions(interpreter string) *RunScriptOptions {
+	return &RunScriptOptions{
+		interpreter: interpreter,
+	}
+}
+
+// ScriptRunner returns a new remote action definition which defines how a local script is to be run
+// on an actor's remote host. The script is copied to a new temporary dir on the remote host, run
+// with the args, and deleted afterwards. The result is the result of the script. An error is
+// returned if the local script cannot be read.
+func ScriptRunner(localScript string, args []string, opts *RunScriptOptions) (remote.Action, error) {
+	scriptPath, err := util.AbsPath(localScript)
+	if err != nil {
+		return nil, fmt.Errorf("cannot use script %s: %+v", localScript, err)
+	}
+	info, err := os.Stat(scriptPath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot use script %s: %+v", localScript, err)
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("cannot use script %s: it is a directory", localScript)
+	}
+
+	return func(a remote.Actor, h *remote.HostInfo) (stdout, stderr *bytes.Buffer, err error) {
+		stdout = new(bytes.Buffer)
+		stderr = new(bytes.Buffer)
+
+		dir, err := makeRemoteTempDir(a)
+		if err != nil {
+			return
+		}
+		defer func() {
+			// clean up even if the script failed, but don't hide the script's own error
+			if rmErr := removeRemoteDir(a, dir); rmErr != nil {
+				stderr.WriteString(fmt.Sprintf("%+v\n", rmErr))
+				if err == nil {
+					err = rmErr
+				}
+			}
+		}()
+
+		remoteScript := path.Join(dir, filepath.Base(scriptPath))
+		if err = copyScript(a, scriptPath, remoteScript, info); err != nil {
+			return
+		}
+
+		cmd := []string{util.ShellQuote(remoteScript)}
+		if opts.interpreter != "" {
+			// the interpreter may have its own args (e.g., 'bash -x'), so it is not quoted
+			cmd = []string{opts.interpreter, util.ShellQuote(remoteScript)}
+		}
+		for _, arg := range args {
+			cmd = append(cmd, util.ShellQuote(arg))
+		}
+		return a.RunCommand(strings.Join(cmd, " "))
+	}, nil
+}
+
+// run a command whose output is only for octopus and never streamed to the user
+func runQuietly(a remote.Actor, command string, cleanup bool) (stdout string, err error) {
+	o, e := new(bytes.Buffer), new(bytes.Buffer)
+	c := &remote.Command{Command: command, Stdout: o, Stderr: e, Cleanup: cleanup}
+	if err := a.StreamCommand(c); err != nil {
+		return "", fmt.Errorf("%+v: %s", err, strings.TrimSpace(e.String()))
+	}
+	return strings.TrimSpace(o.String()), nil
+}
+
+func makeRemoteTempDir(a remote.Actor) (string, error) {
+	dir, err := runQuietly(a, `mktemp -d "${TMPDIR:-/tmp}/octopus-script.XXXXXXXXXX"`, false)
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary dir for script on remote host. %+v", err)
+	}
+	if dir == "" {
+		return "", fmt.Errorf("failed to create temporary dir for script on remote host. no dir was reported")
+	}
+	return dir, nil
+}
+
+// the dir is removed even if octopus has been interrupted
+func removeRemoteDir(a remote.Actor, dir string) error {
+	if _, err := runQuietly(a, "rm -rf "+util.ShellQuote(dir), true); err != nil {
+		return fmt.Errorf("failed to remove temporary script dir %s from remote host. %+v", dir, err)
+	}
+	return nil
+}
+
+// scripts are copied so that only the remote user can read or run them
+type scriptFileInfo struct {
+	os.FileInfo
+}
+
+func (scriptFileInfo) Mode() os.FileMode { return 0700 }
+
+func copyScript(a remote.Actor, localPath, remotePath string, info os.FileInfo) error {
+	filePointers <- struct{}{}        // claim a file pointer resource
+	defer func() { <-filePointers }() // release a file pointer resource on any return
+	s, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("could not open local script %s for reading: %+v", localPath, err)
+	}
+	defer s.Close()
+
+	if err := a.CopyFileToRemote(s, remotePath, scriptFileInfo{info}); err != nil {
+		return fmt.Errorf("failed to copy script %s to remote at %s. %+v", localPath, remotePath, err)
+	}
+	return nil
+}
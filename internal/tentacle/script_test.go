@@ -0,0 +1,124 @@
+package tentacle
+
+import (
+	"context"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/BlaineEXE/octopus/internal/remote"
+	remotetest "github.com/BlaineEXE/octopus/internal/remote/test"
+	"github.com/BlaineEXE/octopus/internal/util/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScriptRunner(t *testing.T) {
+	tmpRoot, cleanup := testutil.TempDir("")
+	defer cleanup()
+	script := path.Join(tmpRoot, "setup.sh")
+	testutil.WriteFile(script, "#!/usr/bin/env bash\necho hi\n", 0644)
+
+	// the mock actor reports its stdout as the temp dir
+	mktemp := `mktemp -d "${TMPDIR:-/tmp}/octopus-script.XXXXXXXXXX"`
+	tmpDir := mktemp + ": stdout ok"
+	remoteScript := path.Join(tmpDir, "setup.sh")
+
+	tests := []struct {
+		name        string
+		args        []string
+		interpreter string
+		copyErr     bool
+		wantRun     string
+		wantErr     bool
+	}{
+		{"no args", []string{}, "", false, "'" + remoteScript + "'", false},
+		{"args are quoted", []string{"-x", "it's here", "$HOME"}, "", false,
+			"'" + remoteScript + `' '-x' 'it'\''s here' '$HOME'`, false},
+		{"interpreter", []string{"a"}, "python3 -u", false, "python3 -u '" + remoteScript + "' 'a'", false},
+		{"copy fails", []string{}, "", true, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &remotetest.MockRemoteActor{}
+			if tt.copyErr {
+				a.CopyFileErrorOn = "setup.sh"
+			}
+			action, err := ScriptRunner(script, tt.args, NewRunScriptOptions(tt.interpreter))
+			assert.NoError(t, err)
+			o, e, err := action(a, &remote.HostInfo{})
+
+			assert.Equal(t, []string{remoteScript}, a.FileCopies)
+			// scripts are executable only by the remote user
+			assert.Equal(t, []os.FileMode{0700}, a.FileCopyModes)
+			// the temp dir is always removed
+			wantCommands := []string{mktemp}
+			if tt.wantRun != "" {
+				wantCommands = append(wantCommands, tt.wantRun)
+			}
+			wantCommands = append(wantCommands, "rm -rf '"+tmpDir+"'")
+			assert.Equal(t, wantCommands, a.Commands)
+
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantRun+": stdout ok", o.String())
+			assert.Equal(t, tt.wantRun+": stderr ok", e.String())
+		})
+	}
+}
+
+func TestScriptRunner_remoteFailure(t *testing.T) {
+	tmpRoot, cleanup := testutil.TempDir("")
+	defer cleanup()
+	script := path.Join(tmpRoot, "setup.sh")
+	testutil.WriteFile(script, "#!/usr/bin/env bash\n", 0644)
+
+	// the temp dir can't be created, so nothing else is done
+	a := &remotetest.MockRemoteActor{CommandError: true}
+	action, err := ScriptRunner(script, []string{}, NewRunScriptOptions(""))
+	assert.NoError(t, err)
+	_, _, err = action(a, &remote.HostInfo{})
+	assert.Error(t, err)
+	assert.Len(t, a.Commands, 1)
+	assert.Len(t, a.FileCopies, 0)
+}
+
+func TestScriptRunner_badScript(t *testing.T) {
+	tmpRoot, cleanup := testutil.TempDir("")
+	defer cleanup()
+
+	_, err := ScriptRunner(path.Join(tmpRoot, "does-not-exist.sh"), []string{}, NewRunScriptOptions(""))
+	assert.Error(t, err)
+
+	_, err = ScriptRunner(tmpRoot, []string{}, NewRunScriptOptions(""))
+	assert.Error(t, err)
+}
+
+func TestScriptRunner_interrupted(t *testing.T) {
+	tmpRoot, cleanup := testutil.TempDir("")
+	defer cleanup()
+	script := path.Join(tmpRoot, "setup.sh")
+	testutil.WriteFile(script, "#!/usr/bin/env bash\nsleep 60\n", 0644)
+
+	mktemp := `mktemp -d "${TMPDIR:-/tmp}/octopus-script.XXXXXXXXXX"`
+	tmpDir := mktemp + ": stdout ok"
+
+	// the script runs until octopus is interrupted
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &remotetest.MockRemoteConnector{ReturnActor: &remotetest.MockRemoteActor{WaitOn: "setup.sh"}}
+	actor, err := c.Connect(ctx, remote.Host{Address: "1.1.1.1"})
+	assert.NoError(t, err)
+	a := actor.(*remotetest.MockRemoteActor)
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	action, err := ScriptRunner(script, []string{}, NewRunScriptOptions(""))
+	assert.NoError(t, err)
+	_, _, err = action(a, &remote.HostInfo{})
+	assert.IsType(t, &remote.InterruptedError{}, err)
+	// the temp dir is still removed
+	assert.Equal(t, []string{mktemp, "'" + path.Join(tmpDir, "setup.sh") + "'", "rm -rf '" + tmpDir + "'"},
+		a.Commands)
+}
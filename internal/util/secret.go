@@ -0,0 +1,60 @@
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/BlaineEXE/octopus/internal/logger"
+	"golang.org/x/term"
+)
+
+// ReadSecret gets a secret (e.g., a passphrase or password) from the user. The secret is read from
+// the environment variable if it is set. Otherwise, the user is prompted for the secret on the
+// terminal, or, if there is no terminal, the secret is read from the program set in SSH_ASKPASS.
+// SSH_ASKPASS is used even if there is a terminal if SSH_ASKPASS_REQUIRE=force.
+func ReadSecret(envVar, prompt string) ([]byte, error) {
+	if s, ok := os.LookupEnv(envVar); ok {
+		logger.Info.Println("reading secret from env var", envVar)
+		return []byte(s), nil
+	}
+
+	askpass := os.Getenv("SSH_ASKPASS")
+	if askpass != "" && os.Getenv("SSH_ASKPASS_REQUIRE") == "force" {
+		return askpassSecret(askpass, prompt)
+	}
+
+	// use the controlling terminal so that a secret can still be entered when stdin is a pipe
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		if askpass != "" {
+			return askpassSecret(askpass, prompt)
+		}
+		return nil, fmt.Errorf("no terminal is available to prompt %q, "+
+			"and neither %s nor SSH_ASKPASS is set. %+v", prompt, envVar, err)
+	}
+	defer tty.Close()
+	return ttySecret(tty, prompt)
+}
+
+func ttySecret(tty *os.File, prompt string) ([]byte, error) {
+	tty.WriteString(prompt)
+	defer tty.WriteString("\n") // the user's newline isn't echoed
+	s, err := term.ReadPassword(int(tty.Fd()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from terminal. %+v", err)
+	}
+	return s, nil
+}
+
+func askpassSecret(askpass, prompt string) ([]byte, error) {
+	logger.Info.Println("reading secret from SSH_ASKPASS program", askpass)
+	cmd := exec.Command(askpass, prompt)
+	cmd.Stderr = os.Stderr
+	o, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from SSH_ASKPASS program %s. %+v", askpass, err)
+	}
+	return bytes.TrimRight(o, "\r\n"), nil
+}
@@ -0,0 +1,75 @@
+package util
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/BlaineEXE/octopus/internal/util/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadSecret(t *testing.T) {
+	tmpRoot, cleanup := testutil.TempDir("")
+	defer cleanup()
+
+	const envVar = "OCTOPUS_TEST_SECRET"
+	runtimeEnv := map[string]string{}
+	for _, v := range []string{envVar, "SSH_ASKPASS", "SSH_ASKPASS_REQUIRE"} {
+		if s, ok := os.LookupEnv(v); ok {
+			runtimeEnv[v] = s
+		}
+	}
+	defer func() {
+		for _, v := range []string{envVar, "SSH_ASKPASS", "SSH_ASKPASS_REQUIRE"} {
+			os.Unsetenv(v)
+			if s, ok := runtimeEnv[v]; ok {
+				os.Setenv(v, s)
+			}
+		}
+	}()
+
+	// askpass programs are given the prompt as their only arg
+	askpass := path.Join(tmpRoot, "askpass")
+	testutil.WriteFile(askpass, "#!/bin/sh\necho \"askpass secret for $1\"\n", 0755)
+	failingAskpass := path.Join(tmpRoot, "failing-askpass")
+	testutil.WriteFile(failingAskpass, "#!/bin/sh\necho 'cancelled' >&2\nexit 1\n", 0755)
+
+	tests := []struct {
+		name    string
+		env     map[string]string // env vars to set; all others are unset
+		want    string
+		wantErr bool
+	}{
+		{"env var", map[string]string{envVar: "env secret"}, "env secret", false},
+		{"empty env var", map[string]string{envVar: ""}, "", false},
+		{"env var takes precedence over askpass",
+			map[string]string{envVar: "env secret", "SSH_ASKPASS": askpass, "SSH_ASKPASS_REQUIRE": "force"},
+			"env secret", false},
+		{"askpass", map[string]string{"SSH_ASKPASS": askpass, "SSH_ASKPASS_REQUIRE": "force"},
+			"askpass secret for Enter secret: ", false},
+		{"askpass fails", map[string]string{"SSH_ASKPASS": failingAskpass, "SSH_ASKPASS_REQUIRE": "force"},
+			"", true},
+		{"askpass does not exist",
+			map[string]string{"SSH_ASKPASS": path.Join(tmpRoot, "nope"), "SSH_ASKPASS_REQUIRE": "force"},
+			"", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, v := range []string{envVar, "SSH_ASKPASS", "SSH_ASKPASS_REQUIRE"} {
+				os.Unsetenv(v)
+			}
+			for v, s := range tt.env {
+				os.Setenv(v, s)
+			}
+			got, err := ReadSecret(envVar, "Enter secret: ")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ReadSecret() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			assert.Equal(t, tt.want, string(got))
+		})
+	}
+}
@@ -0,0 +1,8 @@
+package util
+
+import "strings"
+
+// ShellQuote quotes a string so that a POSIX shell reads it as a single literal word.
+func ShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
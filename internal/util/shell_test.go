@@ -0,0 +1,13 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShellQuote(t *testing.T) {
+	assert.Equal(t, "''", ShellQuote(""))
+	assert.Equal(t, "'a b'", ShellQuote("a b"))
+	assert.Equal(t, `'it'\''s'`, ShellQuote("it's"))
+}
@@ -48,5 +48,30 @@ done
 octopus -g one run "mv ${ls_location}.bkp ${ls_location}" 1> /dev/null
 
 
-assert_success 'with group having no members' octopus -g empty run 'hostname'
+# missing default identity files are warned about, so only use the key which exists
+assert_success 'with group having no members' octopus -g empty -i "$HOME/.ssh/id_rsa" run 'hostname'
 assert_num_output_lines_with_text 0
+
+assert_success 'with stdin sent to all nodes' bash -c 'echo "sent on stdin" | octopus -g all run cat'
+assert_output_count 'sent on stdin' $NUM_HOSTS
+assert_success '  ... and not with --no-stdin' bash -c 'echo "sent on stdin" | octopus -g all -n run "cat"'
+assert_output_count 'sent on stdin' 0
+
+# sshd only accepts variables allowed by AcceptEnv, so this tests the fallback to exported variables
+assert_success 'with env vars' octopus -g all --env 'OCTOPUS_TEST=it'"'"'s a,test' run 'echo "got $OCTOPUS_TEST"'
+assert_output_count "got it's a,test" $NUM_HOSTS
+
+assert_success 'with tty' octopus -g all --tty run 'tty'
+assert_output_count '/dev/pts/' $NUM_HOSTS
+assert_retcode '  ... and not without --tty' $NUM_HOSTS octopus -g all -n run 'tty'
+assert_output_count 'not a tty' $NUM_HOSTS
+
+# log in as a non-root user so that becoming root is what makes the command run as root
+assert_success 'with become' octopus -g all -u tester --become run 'echo "uid=$(id -u)"'
+assert_output_count 'uid=0' $NUM_HOSTS
+assert_success '  ... and not without --become' octopus -g all -u tester run 'echo "uid=$(id -u)"'
+assert_output_count 'uid=0' 0
+
+assert_retcode 'with interrupt' 130 bash -c \
+  'octopus -g all -n run "sleep 60" & pid=$!; sleep 3; kill -INT $pid; wait $pid'
+assert_output_count 'Interrupted: ' $NUM_HOSTS
@@ -94,5 +94,14 @@ fi
 # buffer size greater than 256 kib should cause a failure with OpenSSH
 assert_failure "ludicrous settings" octopus -g all copy -B 1024 -R 1024
 
+# log in as a non-root user and copy to a dir only root can write
+assert_failure 'without become' octopus -g all -u tester copy work/fileA /root/become/
+assert_success 'with become' octopus -g all -u tester --become copy work/fileA /root/become/
+assert_success '  and file is owned by root' octopus -g all run 'stat -c "owner=%U" /root/become/fileA'
+assert_output_count 'owner=root' $NUM_HOSTS
+assert_success '  and file md5sums match' octopus -g all run 'md5sum /root/become/fileA'
+assert_output_count "$(get_md5sum work/fileA)" $NUM_HOSTS
+octopus -g all run 'rm -rf /root/become' 1> /dev/null
+
 # Remove all the files we wrote from the test hosts
 octopus -g all run 'rm -rf /tmp/*' 1> /dev/null
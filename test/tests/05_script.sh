@@ -0,0 +1,37 @@
+#!/usr/bin/env bash
+source tests/shared.sh
+
+echo "Running 'octopus script' tests ..."
+
+mkdir work/
+cat > work/script.sh <<'SCRIPT'
+#!/usr/bin/env bash
+echo "script ran in $(dirname "$0") with args: $*"
+SCRIPT
+# no shebang, so this can only be run with an interpreter
+cat > work/script.txt <<'SCRIPT'
+echo "interpreted script ran with args: $*"
+SCRIPT
+cat > work/fail.sh <<'SCRIPT'
+#!/usr/bin/env bash
+exit 3
+SCRIPT
+
+assert_success 'with script run on all nodes' octopus -g all script work/script.sh --flag 'two words'
+assert_output_count 'with args: --flag two words' $NUM_HOSTS
+for host in $HOSTNAMES; do # hostnames should be reported
+  assert_output_count "$host" 1
+done
+assert_success '  and scripts are removed afterwards' \
+  octopus -g all run 'test -z "$(ls -A /tmp | grep octopus-script)"'
+
+assert_success 'with --interpreter' octopus -g all script --interpreter sh work/script.txt a b
+assert_output_count 'interpreted script ran with args: a b' $NUM_HOSTS
+
+assert_retcode 'with script failure on all nodes' $NUM_HOSTS octopus -g all script work/fail.sh
+assert_success '  and failed scripts are removed afterwards' \
+  octopus -g all run 'test -z "$(ls -A /tmp | grep octopus-script)"'
+
+assert_failure 'with local script not found' octopus -g all script work/does-not-exist.sh
+
+rm -rf work/